@@ -7,30 +7,71 @@ import (
 	"github.com/edwingeng/deque/v2"
 	"io"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redial attempts are spaced by a backoff doubling from the minimum to the maximum
+const (
+	minRedialBackoff = 100 * time.Millisecond
+	maxRedialBackoff = 5 * time.Second
 )
 
 type BaseTCPClient struct {
 	ConnectionTarget
-	conn     net.Conn
-	mu       sync.Mutex
-	deque    *deque.Deque[Request]
-	rw       *bufio.ReadWriter
-	shutdown bool
+	conn      net.Conn
+	mu        sync.Mutex
+	deque     *deque.Deque[Request]
+	rw        *bufio.ReadWriter
+	shutdown  bool
+	connected bool
+	healthy   atomic.Bool
+	// quiet requests were written after the last barrier, and no mn closed it yet
+	openBarrier bool
 }
 
 func NewBaseTCPClient(c ConnectionTarget) (*BaseTCPClient, error) {
+	c, err := c.withDefaults()
+	if err != nil {
+		return nil, err
+	}
 	tcpRawClient := &BaseTCPClient{
 		ConnectionTarget: c,
+		deque:            deque.NewDeque[Request](),
+	}
+	tcpRawClient.healthy.Store(true)
+	if err := tcpRawClient.reconnect(); err != nil {
+		return nil, err
+	}
+	if c.HealthCheckIntervalMs > 0 {
+		go tcpRawClient.healthCheck()
 	}
-	tcpRawClient.reconnect()
 	return tcpRawClient, nil
 }
 
+// Healthy reports whether the server answered the latest health checks
+func (tc *BaseTCPClient) Healthy() bool {
+	return tc.healthy.Load()
+}
+
+// Shutdown closes the connection, failing its outstanding requests, and stops reconnecting
 func (tc *BaseTCPClient) Shutdown() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 	tc.shutdown = true
+	if tc.conn != nil {
+		tc.conn.Close()
+	}
+}
+
+func (tc *BaseTCPClient) isShutdown() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.shutdown
 }
 
 func (tc *BaseTCPClient) reconnect() error {
@@ -40,77 +81,202 @@ func (tc *BaseTCPClient) reconnect() error {
 	if tc.deque != nil {
 		for i, n := 0, tc.deque.Len(); i < n; i++ {
 			r := tc.deque.PopBack()
+			if r.barrier {
+				continue
+			}
 			r.responseChannel <- Response{
 				Header: nil,
 				Value:  nil,
-				Error:  errors.New("connection reset")}
+				Error:  ErrConnectionReset}
 		}
 	}
 
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", tc.Address, tc.Port))
+	if tc.conn != nil {
+		tc.conn.Close()
+	}
+	tc.connected = false
+	tc.openBarrier = false
+	if tc.shutdown {
+		return errors.New("connection is shutdown")
+	}
+
+	conn, err := tc.dial()
+	if tc.Metrics != nil {
+		tc.Metrics.Connect(tc.server(), err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to connect to %s:%d - %v", tc.Address, tc.Port, err)
 	}
 	tc.conn = conn
+	tc.connected = true
 	tc.deque = deque.NewDeque[Request]()
-	tc.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	tc.rw = bufio.NewReadWriter(bufio.NewReaderSize(conn, tc.ReadBufferSize), bufio.NewWriterSize(conn, tc.WriteBufferSize))
 	go tc.listen()
 	return nil
 }
 
-func (tc *BaseTCPClient) Dispatch(r []byte) <-chan Response {
-	rc := make(chan Response)
-	go func() {
-		if tc.shutdown {
-			rc <- Response{
-				Header: nil,
-				Value:  nil,
-				Error:  errors.New("connection is shutdown")}
+// redial reconnects once the connection was lost, retrying with an exponential backoff until it
+// succeeds or the client is shut down, so that clients recover from outages without health checks
+func (tc *BaseTCPClient) redial() {
+	backoff := minRedialBackoff
+	for {
+		err := tc.reconnect()
+		if err == nil || tc.isShutdown() {
 			return
 		}
-		rq := Request{rc}
-		if tc.deque.Len() > tc.MaxOutstandingRequests {
-			rc <- Response{
-				Header: nil,
-				Value:  nil,
-				Error:  ErrConnectionOverloaded}
-			return
+		tc.Logger.Printf("%v, retrying in %v", err, backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxRedialBackoff)
+	}
+}
+
+func (tc *BaseTCPClient) Dispatch(r []byte) <-chan Response {
+	return tc.DispatchMany(r)[0]
+}
+
+// DispatchMany writes all the requests at once and in order, so no other request can
+// interleave with them, and returns a response channel for each of them
+func (tc *BaseTCPClient) DispatchMany(rs ...[]byte) []<-chan Response {
+	if !tc.healthy.Load() {
+		rcs := make([]<-chan Response, len(rs))
+		for i := range rs {
+			rcs[i] = errorResponse(ErrServerUnhealthy)
 		}
-		tc.mu.Lock()
-		defer tc.mu.Unlock()
-		if _, err := tc.rw.Write(r); err != nil {
-			rc <- Response{
+		return rcs
+	}
+	return tc.dispatch(rs...)
+}
+
+func errorResponse(err error) <-chan Response {
+	rc := make(chan Response, 1)
+	rc <- Response{
+		Header: nil,
+		Value:  nil,
+		Error:  err}
+	return rc
+}
+
+func (tc *BaseTCPClient) dispatch(rs ...[]byte) []<-chan Response {
+	// buffered, so that nobody blocks delivering a response the caller gave up on
+	rqs := make([]Request, len(rs))
+	rcs := make([]<-chan Response, len(rs))
+	for i := range rs {
+		rc := make(chan Response, 1)
+		rqs[i] = Request{responseChannel: rc, opaque: opaqueToken(rs[i]), command: commandName(rs[i])}
+		rcs[i] = rc
+	}
+	fail := func(err error) {
+		for _, rq := range rqs {
+			rq.responseChannel <- Response{
 				Header: nil,
 				Value:  nil,
 				Error:  err}
-			return
 		}
-		if err := tc.rw.Flush(); err != nil {
-			rc <- Response{
-				Header: nil,
-				Value:  nil,
-				Error:  err}
-			return
+	}
+	// written on the caller's goroutine, so that requests go out in the order they are dispatched
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.shutdown {
+		fail(errors.New("connection is shutdown"))
+		return rcs
+	}
+	if tc.deque.Len()+len(rs)-1 > tc.MaxOutstandingRequests {
+		fail(ErrConnectionOverloaded)
+		return rcs
+	}
+	if !tc.connected {
+		fail(errors.New("not connected"))
+		return rcs
+	}
+	tc.setWriteDeadline()
+	if tc.openBarrier {
+		// every response until the MN belongs to the quiet requests before it
+		if _, err := tc.rw.WriteString("mn\r\n"); err != nil {
+			fail(tc.writeFailed(err))
+			return rcs
 		}
+		tc.openBarrier = false
+	}
+	for _, r := range rs {
+		if _, err := tc.rw.Write(r); err != nil {
+			fail(tc.writeFailed(err))
+			return rcs
+		}
+	}
+	if err := tc.rw.Flush(); err != nil {
+		fail(tc.writeFailed(err))
+		return rcs
+	}
+	waiting := tc.awaitingResponses()
+	sent := time.Now()
+	for _, rq := range rqs {
+		rq.sent = sent
 		tc.deque.PushFront(rq)
-	}()
-	return rc
+	}
+	if !waiting {
+		// later requests don't extend the deadline, only responses do
+		tc.setReadDeadline()
+	}
+	return rcs
 }
 
-func (tc *BaseTCPClient) listen() {
+// DispatchQuiet writes a request in quiet mode, which the server only answers on failure
+// Nobody waits for those answers, so failures are only reported in the output
+// Quiet requests are followed by a barrier, the meta no-op command, which is written before the
+// next regular request, so that the answers to quiet requests can't be confused with other responses
+func (tc *BaseTCPClient) DispatchQuiet(r []byte) error {
+	if !tc.healthy.Load() {
+		return ErrServerUnhealthy
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 	if tc.shutdown {
-		return
+		return errors.New("connection is shutdown")
 	}
+	if tc.deque.Len() > tc.MaxOutstandingRequests {
+		return ErrConnectionOverloaded
+	}
+	if !tc.connected {
+		return errors.New("not connected")
+	}
+	tc.setWriteDeadline()
+	if _, err := tc.rw.Write(r); err != nil {
+		return tc.writeFailed(err)
+	}
+	if err := tc.rw.Flush(); err != nil {
+		return tc.writeFailed(err)
+	}
+	if !tc.openBarrier {
+		tc.deque.PushFront(Request{barrier: true})
+		tc.openBarrier = true
+	}
+	return nil
+}
+
+func (tc *BaseTCPClient) listen() {
 	reader := tc.rw.Reader
 	for {
 		head, err := reader.ReadString('\n')
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// the connection is most likely half-open, e.g. the server or the network went away
+			tc.Logger.Printf("server %s did not answer within %dms, reconnecting", tc.server(), tc.ReadTimeoutMs)
+			tc.redial()
+			return
+		}
 		if err != nil {
-			fmt.Printf("irrecoverable error reading from server: %v\n", err)
-			tc.reconnect()
+			if !tc.isShutdown() {
+				tc.Logger.Printf("irrecoverable error reading from server: %v", err)
+			}
+			tc.redial()
 			return
 		}
 		var value []byte = nil
 		header := strings.Fields(head)
+		if len(header) == 0 {
+			tc.Logger.Printf("fatal connection error: empty response")
+			tc.redial()
+			return
+		}
 		switch header[0] {
 		case "VA", "VALUE":
 			// only value responses need further reading
@@ -122,29 +288,72 @@ func (tc *BaseTCPClient) listen() {
 			}
 			size, err := strconv.Atoi(sizeString)
 			if err != nil {
-				fmt.Println("fatal connection error parsing response size:", err)
-				tc.reconnect()
+				tc.Logger.Printf("fatal connection error parsing response size: %v", err)
+				tc.redial()
 				return
 			}
 			value = make([]byte, size+2)
 			if _, err = io.ReadFull(reader, value); err != nil {
-				fmt.Printf("fatal connection error reading from server: %v\n", err)
-				tc.reconnect()
+				tc.Logger.Printf("fatal connection error reading from server: %v", err)
+				tc.redial()
 				return
 			}
 			value = value[:len(value)-2]
+		case "STAT":
+			// statistics span many lines, until END
+			var lines strings.Builder
+			lines.WriteString(head)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					tc.Logger.Printf("fatal connection error reading from server: %v", err)
+					tc.redial()
+					return
+				}
+				if strings.TrimSpace(line) == "END" {
+					break
+				}
+				lines.WriteString(line)
+			}
+			value = []byte(lines.String())
 		case "ERROR", "CLIENT_ERROR":
 			err = fmt.Errorf("error reading from server: %s", header[0])
 		}
 		tc.mu.Lock()
 		if tc.deque.Len() == 0 {
 			tc.mu.Unlock()
-			fmt.Printf("empty deque for response: %s\n", head)
-			tc.reconnect()
+			tc.Logger.Printf("empty deque for response: %s", head)
+			tc.redial()
 			return
 		}
+		if next, _ := tc.deque.Back(); next.barrier {
+			if header[0] == "MN" {
+				tc.deque.PopBack()
+				tc.setReadDeadline()
+			} else {
+				tc.Logger.Printf("quiet request failed: %s", strings.TrimSpace(head))
+			}
+			tc.mu.Unlock()
+			continue
+		}
 		req := tc.deque.PopBack()
+		tc.setReadDeadline()
 		tc.mu.Unlock()
+		if !matchesOpaque(header, req.opaque) {
+			// responses are out of sync with the requests, so none of the outstanding
+			// responses can be trusted anymore
+			tc.Logger.Printf("response %s does not match request opaque %s", strings.TrimSpace(head), req.opaque)
+			req.responseChannel <- Response{
+				Header: nil,
+				Value:  nil,
+				Error:  ErrResponseMismatch,
+			}
+			tc.redial()
+			return
+		}
+		if tc.Metrics != nil {
+			tc.Metrics.Response(tc.server(), req.command, time.Since(req.sent), err)
+		}
 		req.responseChannel <- Response{
 			Header: header,
 			Value:  value,
@@ -152,3 +361,139 @@ func (tc *BaseTCPClient) listen() {
 		}
 	}
 }
+
+// setWriteDeadline bounds the time the next writes can take, with the mutex held
+func (tc *BaseTCPClient) setWriteDeadline() {
+	if tc.WriteTimeoutMs > 0 {
+		tc.conn.SetWriteDeadline(time.Now().Add(time.Duration(tc.WriteTimeoutMs) * time.Millisecond))
+	}
+}
+
+// writeFailed closes a connection that failed a write, as it may hold a partial command
+// The listener then fails the outstanding requests, and reconnects
+func (tc *BaseTCPClient) writeFailed(err error) error {
+	tc.conn.Close()
+	return err
+}
+
+// setReadDeadline bounds the time until the next response while responses are awaited, and
+// clears it otherwise, so that idle connections are kept. Called with the mutex held.
+func (tc *BaseTCPClient) setReadDeadline() {
+	if tc.ReadTimeoutMs <= 0 {
+		return
+	}
+	if tc.awaitingResponses() {
+		tc.conn.SetReadDeadline(time.Now().Add(time.Duration(tc.ReadTimeoutMs) * time.Millisecond))
+	} else {
+		tc.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// awaitingResponses reports whether the server owes responses, with the mutex held
+// A lone barrier is only answered once the next request writes the meta no-op
+func (tc *BaseTCPClient) awaitingResponses() bool {
+	switch tc.deque.Len() {
+	case 0:
+		return false
+	case 1:
+		next, _ := tc.deque.Back()
+		return !next.barrier
+	default:
+		return true
+	}
+}
+
+// healthCheck probes the server with the meta no-op command, and marks the connection
+// unhealthy after HealthCheckFailures consecutive failed probes, until a probe succeeds again
+func (tc *BaseTCPClient) healthCheck() {
+	ticker := time.NewTicker(time.Duration(tc.HealthCheckIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	failures := 0
+	for range ticker.C {
+		if tc.isShutdown() {
+			return
+		}
+		if err := tc.probe(); err != nil {
+			failures++
+			if failures >= max(tc.HealthCheckFailures, 1) && tc.healthy.Swap(false) {
+				tc.Logger.Printf("server %s marked unhealthy: %v", tc.server(), err)
+			}
+			continue
+		}
+		failures = 0
+		if !tc.healthy.Swap(true) {
+			tc.Logger.Printf("server %s is healthy again", tc.server())
+		}
+	}
+}
+
+func (tc *BaseTCPClient) probe() error {
+	timeout := tc.TimeoutMs
+	if timeout <= 0 {
+		timeout = tc.HealthCheckIntervalMs
+	}
+	select {
+	case r := <-tc.dispatch([]byte("mn\r\n"))[0]:
+		if r.Error != nil {
+			return r.Error
+		}
+		if len(r.Header) == 0 || r.Header[0] != "MN" {
+			return fmt.Errorf("invalid probe response: %v", r.Header)
+		}
+		return nil
+	case <-time.After(time.Duration(timeout) * time.Millisecond):
+		return ErrRequestTimeout
+	}
+}
+
+// server returns the host:port of the server
+func (tc *BaseTCPClient) server() string {
+	return net.JoinHostPort(tc.Address, strconv.Itoa(tc.Port))
+}
+
+// commandName returns the name of a command, such as mg
+func commandName(command []byte) string {
+	line, _, _ := strings.Cut(string(command), "\r\n")
+	name, _, _ := strings.Cut(line, " ")
+	return name
+}
+
+// opaqueToken returns the opaque token (O flag) of a meta command, if any
+func opaqueToken(command []byte) string {
+	line, _, _ := strings.Cut(string(command), "\r\n")
+	tokens := strings.Fields(line)
+	if len(tokens) < 3 || len(tokens[0]) != 2 || tokens[0][0] != 'm' {
+		return ""
+	}
+	for _, t := range tokens[2:] {
+		if t[0] == 'O' {
+			return t[1:]
+		}
+	}
+	return ""
+}
+
+// matchesOpaque checks that a meta response echoes the opaque token of its request
+// Error responses carry no flags, so they can't be checked
+func matchesOpaque(header []string, opaque string) bool {
+	if opaque == "" {
+		return true
+	}
+	var flags []string
+	switch header[0] {
+	case "VA":
+		if len(header) > 1 {
+			flags = header[2:]
+		}
+	case "HD", "EN", "NF", "NS", "EX":
+		flags = header[1:]
+	default:
+		return true
+	}
+	for _, f := range flags {
+		if f[0] == 'O' {
+			return f[1:] == opaque
+		}
+	}
+	return false
+}
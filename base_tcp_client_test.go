@@ -0,0 +1,144 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpaqueTokens(t *testing.T) {
+	assert.Equal(t, "12", opaqueToken([]byte("mg key t f v O12\r\n")))
+	assert.Equal(t, "7", opaqueToken([]byte("ms Okey 5 T0 O7\r\nvalue\r\n")), "Expected key not to be taken as opaque")
+	assert.Equal(t, "", opaqueToken([]byte("me key\r\n")))
+	assert.Equal(t, "", opaqueToken([]byte("mn\r\n")))
+
+	assert.True(t, matchesOpaque(strings.Fields("VA 5 t-1 O12"), "12"))
+	assert.True(t, matchesOpaque(strings.Fields("EN O12"), "12"))
+	assert.False(t, matchesOpaque(strings.Fields("HD O13"), "12"), "Expected mismatched opaque to be detected")
+	assert.False(t, matchesOpaque(strings.Fields("HD"), "12"), "Expected missing opaque to be detected")
+	assert.True(t, matchesOpaque(strings.Fields("CLIENT_ERROR bad command line format"), "12"), "Expected errors not to be checked")
+	assert.True(t, matchesOpaque(strings.Fields("MN"), ""), "Expected requests without opaque not to be checked")
+}
+
+func TestOpaqueMismatch(t *testing.T) {
+	s := fakeMemcached(t)
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "mg mismatched ") {
+			return memcachedtest.Action{Response: "VA 5 O999999\r\nwrong\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	c, err := SingleTargetClient(fakeTarget(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	v, err := c.Get("mismatched")
+	assert.ErrorIs(t, err, ErrResponseMismatch)
+	assert.Nil(t, v, "Expected the mismatched value not to be delivered")
+
+	assert.Eventually(t, func() bool {
+		_, err := c.Set("key", []byte("value"), 0)
+		return err == nil
+	}, 2*time.Second, 20*time.Millisecond, "Expected the client to reconnect")
+	v, err = c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v)
+}
+
+func TestReadTimeoutReconnects(t *testing.T) {
+	s := fakeMemcached(t)
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "mg unresponsive") {
+			return memcachedtest.Action{Delay: time.Second}
+		}
+		return memcachedtest.Action{}
+	})
+	target := fakeTarget(s)
+	target.ReadTimeoutMs = 100
+	c, err := SingleTargetClient(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// an idle connection is kept, the deadline only applies while responses are due
+	time.Sleep(200 * time.Millisecond)
+	_, err = c.Set("key", []byte("value"), 0)
+	assert.NoError(t, err, "Expected idle connection to be kept")
+
+	start := time.Now()
+	_, err = c.Get("unresponsive")
+	assert.ErrorIs(t, err, ErrConnectionReset, "Expected unanswered request to fail")
+	assert.Less(t, time.Since(start), time.Second, "Expected the read deadline to fail the request")
+
+	assert.Eventually(t, func() bool {
+		gr, err := c.Get("key")
+		return err == nil && string(gr) == "value"
+	}, 2*time.Second, 50*time.Millisecond, "Expected the client to reconnect")
+}
+
+func TestReconnectsWithoutHealthChecks(t *testing.T) {
+	s := fakeMemcached(t)
+	c, err := SingleTargetClient(fakeTarget(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	_, err = c.Set("key", []byte("value"), 0)
+	assert.NoError(t, err)
+
+	s.Close()
+	_, err = c.Get("key")
+	assert.Error(t, err, "Expected requests to fail while the server is down")
+	// let a few redial attempts fail
+	time.Sleep(300 * time.Millisecond)
+
+	restarted, err := memcachedtest.NewServerAt(s.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	assert.Eventually(t, func() bool {
+		r, err := c.Set("key", []byte("value"), 0)
+		return err == nil && r == Success
+	}, 2*time.Second, 50*time.Millisecond, "Expected the client to reconnect once the server is back")
+}
+
+func TestHealthChecks(t *testing.T) {
+	s := fakeMemcached(t)
+	var slow atomic.Bool
+	s.SetHook(func(command string) memcachedtest.Action {
+		if command == "mn" && slow.Load() {
+			return memcachedtest.Action{Delay: 200 * time.Millisecond}
+		}
+		return memcachedtest.Action{}
+	})
+	target := fakeTarget(s)
+	target.TimeoutMs, target.HealthCheckIntervalMs, target.HealthCheckFailures = 100, 20, 2
+	c, err := SingleTargetClient(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	_, err = c.Set("key", []byte("value"), 0)
+	assert.NoError(t, err)
+
+	slow.Store(true)
+	assert.Eventually(t, func() bool {
+		_, err := c.Get("key")
+		return errors.Is(err, ErrServerUnhealthy)
+	}, 2*time.Second, 10*time.Millisecond, "Expected requests to fail fast once probes time out")
+
+	slow.Store(false)
+	assert.Eventually(t, func() bool {
+		v, err := c.Get("key")
+		return err == nil && string(v) == "value"
+	}, 5*time.Second, 10*time.Millisecond, "Expected the server to recover once probes succeed")
+}
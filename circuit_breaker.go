@@ -0,0 +1,454 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	Closed CircuitState = iota
+	Open
+	HalfOpen
+)
+
+// CircuitBreakerSettings configures a per server circuit breaker
+// The breaker opens when, within a window of WindowMs, at least MinRequests were made and the
+// ratio of failed ones (errors, including timeouts) reached FailureRate. It then rejects every
+// request for OpenMs, after which HalfOpenRequests trial requests are let through: a single
+// failure opens it again, while all of them succeeding closes it.
+// Zero fields take their defaults, see DefaultFailureRate and the following constants
+type CircuitBreakerSettings struct {
+	FailureRate      float64
+	MinRequests      int
+	WindowMs         int
+	OpenMs           int
+	HalfOpenRequests int
+}
+
+const (
+	DefaultFailureRate      = 0.5
+	DefaultMinRequests      = 10
+	DefaultWindowMs         = 10000
+	DefaultOpenMs           = 1000
+	DefaultHalfOpenRequests = 1
+)
+
+// validate rejects negative fields, and failure rates over 1, with ErrInvalidOption
+func (s CircuitBreakerSettings) validate() error {
+	if s.FailureRate < 0 || s.FailureRate > 1 {
+		return fmt.Errorf("%w: circuit breaker failure rate %v is not within [0, 1]", ErrInvalidOption, s.FailureRate)
+	}
+	return errors.Join(
+		notNegative("circuit breaker min requests", s.MinRequests),
+		notNegative("circuit breaker window", s.WindowMs),
+		notNegative("circuit breaker open time", s.OpenMs),
+		notNegative("circuit breaker half open requests", s.HalfOpenRequests),
+	)
+}
+
+// withDefaults replaces the fields that aren't positive with their defaults
+func (s CircuitBreakerSettings) withDefaults() CircuitBreakerSettings {
+	if s.FailureRate <= 0 || s.FailureRate > 1 {
+		s.FailureRate = DefaultFailureRate
+	}
+	for _, d := range []struct {
+		field *int
+		value int
+	}{
+		{&s.MinRequests, DefaultMinRequests},
+		{&s.WindowMs, DefaultWindowMs},
+		{&s.OpenMs, DefaultOpenMs},
+		{&s.HalfOpenRequests, DefaultHalfOpenRequests},
+	} {
+		if *d.field <= 0 {
+			*d.field = d.value
+		}
+	}
+	return s
+}
+
+// A CircuitBreaker wraps a MemcacheClient, failing fast with ErrCircuitOpen while open
+// It implements the optional interfaces, failing with ErrNotSupported when the wrapped client doesn't
+type CircuitBreaker struct {
+	client      MemcacheClient
+	settings    CircuitBreakerSettings
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+}
+
+// Creates a CircuitBreaker, settings that are zero or out of range take their defaults
+func NewCircuitBreaker(client MemcacheClient, settings CircuitBreakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{client: client, settings: settings.withDefaults(), windowStart: time.Now()}
+}
+
+// State returns the current state of the breaker
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == Open && time.Since(cb.openedAt) >= cb.openDuration() {
+		return HalfOpen
+	}
+	return cb.state
+}
+
+// Healthy reports the health of the wrapped client, if it knows about it
+func (cb *CircuitBreaker) Healthy() bool {
+	return isHealthy(cb.client)
+}
+
+// Unwrap returns the wrapped client
+func (cb *CircuitBreaker) Unwrap() MemcacheClient {
+	return cb.client
+}
+
+func (cb *CircuitBreaker) openDuration() time.Duration {
+	return time.Duration(cb.settings.OpenMs) * time.Millisecond
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	return cb.settings.HalfOpenRequests
+}
+
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case Open:
+		if time.Since(cb.openedAt) < cb.openDuration() {
+			return ErrCircuitOpen
+		}
+		cb.state = HalfOpen
+		cb.trials = 0
+		cb.successes = 0
+		fallthrough
+	case HalfOpen:
+		if cb.trials >= cb.halfOpenRequests() {
+			return ErrCircuitOpen
+		}
+		cb.trials++
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	if errors.Is(err, ErrInvalidKey) || errors.Is(err, ErrNotBatchable) || errors.Is(err, ErrNotSupported) {
+		// the request never reached the server
+		err = nil
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := time.Now()
+	switch cb.state {
+	case HalfOpen:
+		if err != nil {
+			cb.trip(now)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.halfOpenRequests() {
+			cb.state = Closed
+			cb.resetWindow(now)
+		}
+	case Closed:
+		if now.Sub(cb.windowStart) > time.Duration(cb.settings.WindowMs)*time.Millisecond {
+			cb.resetWindow(now)
+		}
+		cb.requests++
+		if err != nil {
+			cb.failures++
+		}
+		if cb.requests >= cb.settings.MinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= cb.settings.FailureRate {
+			cb.trip(now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) trip(now time.Time) {
+	cb.state = Open
+	cb.openedAt = now
+}
+
+func (cb *CircuitBreaker) resetWindow(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+}
+
+func (cb *CircuitBreaker) Add(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := cb.client.Add(key, value, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) AddItem(key string, item Item) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := addItem(cb.client, key, item)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Append(key string, value []byte) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := appendTo(cb.client, key, value)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) AppendOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := appendOrCreate(cb.client, key, value, ttl)
+	cb.record(err)
+	return r, err
+}
+
+// Batch counts as a single request, failed if any of its operations failed
+func (cb *CircuitBreaker) Batch(ops []BatchOp) []BatchResult {
+	if err := cb.allow(); err != nil {
+		results := make([]BatchResult, len(ops))
+		for i := range results {
+			results[i] = BatchResult{Result: Error, Error: err}
+		}
+		return results
+	}
+	results := batch(cb.client, ops)
+	var err error
+	for _, r := range results {
+		if r.Error != nil && !errors.Is(r.Error, ErrInvalidKey) && !errors.Is(r.Error, ErrNotBatchable) && !errors.Is(r.Error, ErrNotSupported) {
+			err = r.Error
+			break
+		}
+	}
+	cb.record(err)
+	return results
+}
+
+func (cb *CircuitBreaker) DeleteAsync(key string) *Future[MutationResult] {
+	if err := cb.allow(); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return recordFuture(cb, deleteAsync(cb.client, key))
+}
+
+func (cb *CircuitBreaker) Delete(key string) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := cb.client.Delete(key)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Get(key string) ([]byte, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	v, err := cb.client.Get(key)
+	cb.record(err)
+	return v, err
+}
+
+func (cb *CircuitBreaker) DeleteNoReply(key string) error {
+	if err := cb.allow(); err != nil {
+		return err
+	}
+	err := deleteNoReply(cb.client, key)
+	cb.record(err)
+	return err
+}
+
+func (cb *CircuitBreaker) GetAsync(key string) *Future[[]byte] {
+	if err := cb.allow(); err != nil {
+		return failedFuture[[]byte](err)
+	}
+	return recordFuture(cb, getAsync(cb.client, key))
+}
+
+func (cb *CircuitBreaker) GetAndDelete(key string) ([]byte, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	v, err := getAndDelete(cb.client, key)
+	cb.record(err)
+	return v, err
+}
+
+func (cb *CircuitBreaker) GetAndTouch(key string, ttl int) ([]byte, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	v, err := getAndTouch(cb.client, key, ttl)
+	cb.record(err)
+	return v, err
+}
+
+func (cb *CircuitBreaker) GetEx(key string, opts GetOptions) (GetResult, error) {
+	if err := cb.allow(); err != nil {
+		return GetResult{}, err
+	}
+	r, err := getEx(cb.client, key, opts)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) GetItem(key string) (*Item, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	i, err := getItem(cb.client, key)
+	cb.record(err)
+	return i, err
+}
+
+func (cb *CircuitBreaker) GetMany(keys []string) (map[string][]byte, error) {
+	return cb.client.GetMany(keys)
+}
+
+func (cb *CircuitBreaker) GetRecache(key string, recacheTtl int) (RecacheResult, error) {
+	if err := cb.allow(); err != nil {
+		return RecacheResult{}, err
+	}
+	r, err := getRecache(cb.client, key, recacheTtl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Info(key string) (EntryInfo, error) {
+	if err := cb.allow(); err != nil {
+		return EntryInfo{}, err
+	}
+	i, err := cb.client.Info(key)
+	cb.record(err)
+	return i, err
+}
+
+func (cb *CircuitBreaker) Invalidate(key string, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := invalidate(cb.client, key, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Prepend(key string, value []byte) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := prepend(cb.client, key, value)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) PrependOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := prependOrCreate(cb.client, key, value, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Replace(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := cb.client.Replace(key, value, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) ReplaceItem(key string, item Item) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := replaceItem(cb.client, key, item)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) Set(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := cb.client.Set(key, value, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) SetAsync(key string, value []byte, ttl int) *Future[MutationResult] {
+	if err := cb.allow(); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return recordFuture(cb, setAsync(cb.client, key, value, ttl))
+}
+
+func (cb *CircuitBreaker) SetItem(key string, item Item) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := setItem(cb.client, key, item)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) SetNoReply(key string, value []byte, ttl int) error {
+	if err := cb.allow(); err != nil {
+		return err
+	}
+	err := setNoReply(cb.client, key, value, ttl)
+	cb.record(err)
+	return err
+}
+
+func (cb *CircuitBreaker) Touch(key string, ttl int) (MutationResult, error) {
+	if err := cb.allow(); err != nil {
+		return Error, err
+	}
+	r, err := cb.client.Touch(key, ttl)
+	cb.record(err)
+	return r, err
+}
+
+func (cb *CircuitBreaker) TouchAsync(key string, ttl int) *Future[MutationResult] {
+	if err := cb.allow(); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return recordFuture(cb, touchAsync(cb.client, key, ttl))
+}
+
+// recordFuture records the result of the future in the breaker when it's waited on
+// Futures nobody waits on aren't recorded, so the trials of a half-open breaker must be waited on
+func recordFuture[T any](cb *CircuitBreaker, f *Future[T]) *Future[T] {
+	return newFuture(func() (T, error) {
+		v, err := f.Wait()
+		cb.record(err)
+		return v, err
+	})
+}
+
+func (cb *CircuitBreaker) Shutdown() {
+	cb.client.Shutdown()
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyClient struct {
+	MemcacheClient
+	err   error
+	calls int
+}
+
+func (f *flakyClient) Get(key string) ([]byte, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	inner := &flakyClient{err: ErrRequestTimeout}
+	cb := NewCircuitBreaker(inner, CircuitBreakerSettings{
+		FailureRate:      0.5,
+		MinRequests:      4,
+		WindowMs:         10000,
+		OpenMs:           50,
+		HalfOpenRequests: 1,
+	})
+
+	for i := 0; i < 4; i++ {
+		_, err := cb.Get("key")
+		assert.ErrorIs(t, err, ErrRequestTimeout, "Expected errors from the server while closed")
+	}
+	assert.Equal(t, Open, cb.State(), "Expected breaker to open")
+
+	_, err := cb.Get("key")
+	assert.ErrorIs(t, err, ErrCircuitOpen, "Expected fast failure while open")
+	assert.Equal(t, 4, inner.calls, "Expected no call to reach the server while open")
+
+	// a failed trial opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, HalfOpen, cb.State(), "Expected breaker to be half open")
+	_, err = cb.Get("key")
+	assert.ErrorIs(t, err, ErrRequestTimeout, "Expected trial request to reach the server")
+	assert.Equal(t, Open, cb.State(), "Expected breaker to open again")
+
+	// a successful trial closes it
+	time.Sleep(60 * time.Millisecond)
+	inner.err = nil
+	_, err = cb.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, Closed, cb.State(), "Expected breaker to close")
+}
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	inner := &flakyClient{}
+	cb := NewCircuitBreaker(inner, CircuitBreakerSettings{MinRequests: 2})
+
+	for i := 0; i < 4; i++ {
+		_, err := cb.Get("key")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, Closed, cb.State(), "Expected successful requests to keep the breaker closed")
+	assert.Equal(t, DefaultFailureRate, cb.settings.FailureRate)
+	assert.Equal(t, DefaultOpenMs, cb.settings.OpenMs)
+}
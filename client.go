@@ -1,15 +1,21 @@
 package client
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var ErrConnectionOverloaded = errors.New("connection overloaded")
 var ErrRequestTimeout = errors.New("request timeout")
+var ErrServerUnhealthy = errors.New("server unhealthy")
+var ErrResponseMismatch = errors.New("response does not match request")
+var ErrConnectionReset = errors.New("connection reset")
+var ErrUnsupportedServer = errors.New("server does not support the meta protocol")
 
 // MutationResult contains information about the outcome of a mutation operation (anything but get or info)
 type MutationResult int
@@ -32,7 +38,57 @@ type EntryInfo struct {
 	Size        int
 }
 
+// Item is an entry value along with its client flags and time to live
+// Flags are opaque to memcached, and are commonly used to encode the serialization format of the value
+// When read with GetItem, TimeToLive is the remaining time to live, so the Item can be stored back as is
+type Item struct {
+	Value      []byte
+	Flags      uint32
+	TimeToLive int
+}
+
+// GetOptions selects which metadata GetEx requests along with the entry
+type GetOptions struct {
+	Value      bool
+	Flags      bool
+	TimeToLive bool
+	CasId      bool
+	LastAccess bool
+	Size       bool
+	HitBefore  bool
+	Key        bool
+}
+
+// GetResult contains an entry and the metadata requested with GetOptions
+// Found is false on a miss, in which case every other field is empty
+// TimeToLive is the remaining time to live in seconds, -1 when the entry doesn't expire
+// LastAccess is the amount of seconds since the entry was last accessed
+// HitBefore is true when the entry was accessed before this request
+type GetResult struct {
+	Found      bool
+	Value      []byte
+	Flags      uint32
+	TimeToLive int
+	CasId      int
+	LastAccess int
+	Size       int
+	HitBefore  bool
+	Key        string
+}
+
+// RecacheResult is the outcome of a GetRecache, implementing stale-while-revalidate
+// Value is nil on a miss. When Won is true the caller is the only one that got the right to
+// recompute the entry, and is expected to store it. Stale is true when the entry was invalidated,
+// and WinPending when another caller already won the right to recompute it.
+type RecacheResult struct {
+	Value      []byte
+	Won        bool
+	Stale      bool
+	WinPending bool
+}
+
 // A MemcacheClient is a client implementation that supports memcached operations
+// Further operations are supported by implementing the optional interfaces, such as ItemClient
 type MemcacheClient interface {
 	Add(key string, value []byte, ttl int) (MutationResult, error)
 	Delete(key string) (MutationResult, error)
@@ -46,46 +102,125 @@ type MemcacheClient interface {
 }
 
 // ConnectionTarget is the information used to locate and connect to a memcached server
+// Health checks are disabled when HealthCheckIntervalMs is 0, otherwise the server is probed
+// every interval, and considered unhealthy after HealthCheckFailures consecutive failed probes
+// When CircuitBreaker is set, requests to the server go through a CircuitBreaker
+// Keys must be at most 250 bytes, without whitespace or control characters, unless BinaryKeys is set,
+// in which case such keys are sent base64 encoded, and can hold arbitrary bytes
+// PoolSize is the number of connections used for reads, and as many for mutations
+// Zero fields take their defaults, see DefaultMaxOutstandingRequests and the following constants,
+// and negative ones are rejected with ErrInvalidOption
 type ConnectionTarget struct {
 	Address                string
 	Port                   int
 	MaxOutstandingRequests int
 	TimeoutMs              int
+	DialTimeoutMs          int
+	ReadTimeoutMs          int
+	WriteTimeoutMs         int
+	KeepAliveMs            int
+	HealthCheckIntervalMs  int
+	HealthCheckFailures    int
+	CircuitBreaker         *CircuitBreakerSettings
+	BinaryKeys             bool
+	TLS                    *tls.Config
+	PoolSize               int
+	ReadBufferSize         int
+	WriteBufferSize        int
+	Logger                 Logger
+	Metrics                Metrics
 }
 
 // A Client is an instance of the metapipe client
 // You should be using only this
 type Client struct {
 	router Router
+	denied Operation
 }
 
 // Creates a Client that connects to a single memcached server
 func SingleTargetClient(target ConnectionTarget) (Client, error) {
-	ic, err := NewInnerMetaClient(target)
+	ic, err := newTargetClient(target)
 	if err != nil {
 		return Client{}, fmt.Errorf("error creating connection: %w", err)
 	}
-	return Client{
-		router: &DirectRouter{client: ic},
-	}, nil
+	return NewClient(NewDirectRouter(ic))
+
+}
+
+// Creates a Client routing its operations with a custom Router
+// Routers that are a ClientLister must list at least one client
+// Connection options fail with ErrInvalidOption, as the clients of the router are already connected
+func NewClient(router Router, opts ...Option) (Client, error) {
+	if router == nil {
+		return Client{}, errors.New("nil router")
+	}
+	if l, ok := router.(ClientLister); ok && len(l.Clients()) == 0 {
+		return Client{}, errors.New("router without clients")
+	}
+	o, err := applyOptions(opts)
+	if err != nil {
+		return Client{}, err
+	}
+	if len(o.connection) > 0 {
+		return Client{}, fmt.Errorf("%w: %s only apply to the clients created with New", ErrInvalidOption, strings.Join(o.connection, ", "))
+	}
+	return Client{router: router, denied: o.denied}, nil
+}
 
+// Creates the client of a single server, to build custom routers with
+// It is an InnerMetaClient, wrapped in a CircuitBreaker when the target sets one
+func NewTargetClient(target ConnectionTarget) (MemcacheClient, error) {
+	return newTargetClient(target)
 }
 
-// Creates a default Client, server strings in the format host:ip
+func newTargetClient(target ConnectionTarget) (MemcacheClient, error) {
+	ic, err := NewInnerMetaClient(target)
+	if err != nil {
+		return nil, err
+	}
+	if target.CircuitBreaker != nil {
+		return NewCircuitBreaker(ic, *target.CircuitBreaker), nil
+	}
+	return ic, nil
+}
+
+// Creates a default Client, server strings in the format host:port
 func DefaultClient(servers ...string) (Client, error) {
-	targets := make([]ConnectionTarget, 0, len(servers))
+	return New(servers)
+}
+
+// Creates a Client connecting to the servers, in the format host:port, configured with options
+// Unset options take their defaults, and health checks run every second
+func New(servers []string, opts ...Option) (Client, error) {
+	if len(servers) == 0 {
+		return Client{}, errors.New("no servers")
+	}
+	o, err := applyOptions(append([]Option{WithHealthCheck(time.Second, 3)}, opts...))
+	if err != nil {
+		return Client{}, err
+	}
+	clients := make([]MemcacheClient, 0, len(servers))
 	for _, server := range servers {
 		h, p, err := splitHostPort(server)
-		if err != nil {
-			return Client{}, fmt.Errorf("error creating connection for server %s: %w", server, err)
+		if err == nil {
+			target := o.target
+			target.Address, target.Port = h, p
+			var mc MemcacheClient
+			if mc, err = newTargetClient(target); err == nil {
+				clients = append(clients, mc)
+				continue
+			}
 		}
-		targets = append(targets, ConnectionTarget{Address: h, Port: p, MaxOutstandingRequests: 1000, TimeoutMs: 1000})
+		for _, mc := range clients {
+			mc.Shutdown()
+		}
+		return Client{}, fmt.Errorf("error creating connection for server %s: %w", server, err)
 	}
-	if len(targets) == 1 {
-		return SingleTargetClient(targets[0])
-	} else {
-		return ShardedClient(targets...)
+	if len(clients) == 1 {
+		return Client{router: NewDirectRouter(clients[0]), denied: o.denied}, nil
 	}
+	return Client{router: NewShardedRouter(clients...), denied: o.denied}, nil
 }
 
 func splitHostPort(input string) (string, int, error) {
@@ -114,40 +249,126 @@ func ShardedClient(targets ...ConnectionTarget) (Client, error) {
 	clients := make([]MemcacheClient, 0, len(targets))
 
 	for _, target := range targets {
-		ic, err := NewInnerMetaClient(target)
+		ic, err := newTargetClient(target)
 		if err != nil {
+			for _, mc := range clients {
+				mc.Shutdown()
+			}
 			return Client{}, fmt.Errorf("error creating connection: %w", err)
 		}
 		clients = append(clients, ic)
 	}
 
-	return Client{
-		router: &ShardedRouter{clients: clients},
-	}, nil
+	return NewClient(NewShardedRouter(clients...))
 
 }
 
 // Stores an entry ONLY if the key does NOT exist in the server
 func (c *Client) Add(key string, value []byte, ttl int) (MutationResult, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpAdd); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpAdd)
 	return s.Add(key, value, ttl)
 }
 
+// Stores an item ONLY if the key does NOT exist in the server
+func (c *Client) AddItem(key string, item Item) (MutationResult, error) {
+	if err := c.allowed(OpAdd); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpAdd)
+	return addItem(s, key, item)
+}
+
+// Appends data to the value of an entry ONLY if the key DOES exist in the server
+func (c *Client) Append(key string, value []byte) (MutationResult, error) {
+	if err := c.allowed(OpAppend); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpAppend)
+	return appendTo(s, key, value)
+}
+
+// Appends data to the value of an entry, creating it with the given TTL if the key does NOT exist
+func (c *Client) AppendOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := c.allowed(OpAppend); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpAppend)
+	return appendOrCreate(s, key, value, ttl)
+}
+
 // Deletes an entry
 func (c *Client) Delete(key string) (MutationResult, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpDelete); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpDelete)
 	return s.Delete(key)
 }
 
 // Gets the contents of an entry
 func (c *Client) Get(key string) ([]byte, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpGet); err != nil {
+		return nil, err
+	}
+	s := c.route(key, OpGet)
 	return s.Get(key)
 }
 
+// Deletes an entry without waiting for the server to answer, which it only does on failure
+// The returned error only reports failures to send the request, server failures are printed
+func (c *Client) DeleteNoReply(key string) error {
+	if err := c.allowed(OpDelete); err != nil {
+		return err
+	}
+	s := c.route(key, OpDelete)
+	return deleteNoReply(s, key)
+}
+
+// Gets the contents of an entry and deletes it
+func (c *Client) GetAndDelete(key string) ([]byte, error) {
+	if err := c.allowed(OpGet | OpDelete); err != nil {
+		return nil, err
+	}
+	s := c.route(key, OpGet|OpDelete)
+	return getAndDelete(s, key)
+}
+
+// Gets the contents of an entry and updates its time to live, in a single round trip
+func (c *Client) GetAndTouch(key string, ttl int) ([]byte, error) {
+	if err := c.allowed(OpGet | OpTouch); err != nil {
+		return nil, err
+	}
+	s := c.route(key, OpGet|OpTouch)
+	return getAndTouch(s, key, ttl)
+}
+
+// Gets an entry along with its client flags and remaining time to live, nil if not found
+func (c *Client) GetItem(key string) (*Item, error) {
+	if err := c.allowed(OpGet); err != nil {
+		return nil, err
+	}
+	s := c.route(key, OpGet)
+	return getItem(s, key)
+}
+
+// Gets an entry along with the metadata selected in opts, in a single round trip
+func (c *Client) GetEx(key string, opts GetOptions) (GetResult, error) {
+	if err := c.allowed(OpGet); err != nil {
+		return GetResult{}, err
+	}
+	s := c.route(key, OpGet)
+	return getEx(s, key, opts)
+}
+
 // Gets many entries
 // This method ignores errors, and turn them into the equivalent of cache misses
 func (c *Client) GetMany(keys []string) (map[string][]byte, error) {
+	if err := c.allowed(OpGet); err != nil {
+		return nil, err
+	}
 	result := make(map[string][]byte, len(keys))
 	var mu sync.Mutex
 	var wg sync.WaitGroup
@@ -161,8 +382,8 @@ func (c *Client) GetMany(keys []string) (map[string][]byte, error) {
 			defer mu.Unlock()
 			if err != nil {
 				// even if a single get results in error, we don't want it to bring down
-				// the whole GetMany operation, so we print it and move on
-				fmt.Printf("error getting key %s: %s", key, err)
+				// the whole GetMany operation, so we log it and move on
+				loggerOf(c.route(key, OpGet)).Printf("error getting key %s: %s", key, err)
 				result[key] = nil
 			} else {
 				result[key] = r
@@ -173,27 +394,105 @@ func (c *Client) GetMany(keys []string) (map[string][]byte, error) {
 	return result, nil
 }
 
+// Gets an entry, handing out the right to recompute it to a single caller when the entry
+// is stale (see Invalidate), or when its remaining TTL is below recacheTtl
+func (c *Client) GetRecache(key string, recacheTtl int) (RecacheResult, error) {
+	if err := c.allowed(OpGet); err != nil {
+		return RecacheResult{}, err
+	}
+	s := c.route(key, OpGet)
+	return getRecache(s, key, recacheTtl)
+}
+
 // Gets the information about an entry
 func (c *Client) Info(key string) (EntryInfo, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpInfo); err != nil {
+		return EntryInfo{}, err
+	}
+	s := c.route(key, OpInfo)
 	return s.Info(key)
 }
 
+// Marks an entry as stale instead of deleting it, and updates its TTL
+// Stale entries are still returned by GetRecache, which hands out the right to recompute them
+func (c *Client) Invalidate(key string, ttl int) (MutationResult, error) {
+	if err := c.allowed(OpInvalidate); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpInvalidate)
+	return invalidate(s, key, ttl)
+}
+
+// Prepends data to the value of an entry ONLY if the key DOES exist in the server
+func (c *Client) Prepend(key string, value []byte) (MutationResult, error) {
+	if err := c.allowed(OpPrepend); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpPrepend)
+	return prepend(s, key, value)
+}
+
+// Prepends data to the value of an entry, creating it with the given TTL if the key does NOT exist
+func (c *Client) PrependOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	if err := c.allowed(OpPrepend); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpPrepend)
+	return prependOrCreate(s, key, value, ttl)
+}
+
 // Stores an entry ONLY if the key DOES exist in the server
 func (c *Client) Replace(key string, value []byte, ttl int) (MutationResult, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpReplace); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpReplace)
 	return s.Replace(key, value, ttl)
 }
 
+// Stores an item ONLY if the key DOES exist in the server
+func (c *Client) ReplaceItem(key string, item Item) (MutationResult, error) {
+	if err := c.allowed(OpReplace); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpReplace)
+	return replaceItem(s, key, item)
+}
+
 // Stores an entry
 func (c *Client) Set(key string, value []byte, ttl int) (MutationResult, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpSet); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpSet)
 	return s.Set(key, value, ttl)
 }
 
+// Stores an item
+func (c *Client) SetItem(key string, item Item) (MutationResult, error) {
+	if err := c.allowed(OpSet); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpSet)
+	return setItem(s, key, item)
+}
+
+// Stores an entry without waiting for the server to answer, which it only does on failure
+// The returned error only reports failures to send the request, server failures are printed
+func (c *Client) SetNoReply(key string, value []byte, ttl int) error {
+	if err := c.allowed(OpSet); err != nil {
+		return err
+	}
+	s := c.route(key, OpSet)
+	return setNoReply(s, key, value, ttl)
+}
+
 // Updates the time to live of an entry
 func (c *Client) Touch(key string, ttl int) (MutationResult, error) {
-	s := c.router.Route(key)
+	if err := c.allowed(OpTouch); err != nil {
+		return Error, err
+	}
+	s := c.route(key, OpTouch)
 	return s.Touch(key, ttl)
 }
 
@@ -0,0 +1,129 @@
+// Command metapipe-migrate copies the entries of a memcached cluster to another one, keeping their
+// flags and remaining time to live, for example to warm up a resized cluster before switching to it.
+//
+// Usage:
+//
+//	metapipe-migrate -from host:port,host:port -to host:port,host:port [-overwrite] [-mode all|hash] [-batch n]
+//
+// Keys are enumerated with the LRU crawler of the source servers. Entries are only added to the
+// destination by default, so that entries already written there, for example by clients writing
+// to both clusters during the migration, are never replaced by older copies.
+//
+// Deletes aren't safe to run alongside though: an entry deleted or invalidated in both clusters
+// after it was read from the source, but before it's added to the destination, is brought back
+// in the destination with its old value, until it expires or is deleted again.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	client "github.com/jsp-lqk/metapipe-memcached"
+)
+
+type stats struct {
+	copied  int
+	skipped int
+	failed  int
+}
+
+func main() {
+	from := flag.String("from", "", "comma separated source servers, host:port")
+	to := flag.String("to", "", "comma separated destination servers, host:port")
+	overwrite := flag.Bool("overwrite", false, "replace entries that already exist in the destination")
+	mode := flag.String("mode", string(client.DumpAll), "crawler dump mode, all or hash")
+	batch := flag.Int("batch", 100, "number of entries copied at once")
+	flag.Parse()
+
+	if *from == "" || *to == "" || *batch <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, err := client.DefaultClient(strings.Split(*from, ",")...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to source: %v\n", err)
+		os.Exit(1)
+	}
+	defer src.Shutdown()
+	dst, err := client.DefaultClient(strings.Split(*to, ",")...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to destination: %v\n", err)
+		os.Exit(1)
+	}
+	defer dst.Shutdown()
+
+	s, err := migrate(&src, &dst, client.DumpMode(*mode), *batch, *overwrite)
+	fmt.Printf("copied %d, skipped %d, failed %d\n", s.copied, s.skipped, s.failed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// migrate copies every entry dumped by src to dst, batch keys at a time
+func migrate(src, dst *client.Client, mode client.DumpMode, batch int, overwrite bool) (stats, error) {
+	var s stats
+	it := src.DumpKeys(mode)
+	defer it.Close()
+	keys := make([]string, 0, batch)
+	for it.Next() {
+		keys = append(keys, it.Entry().Key)
+		if len(keys) == batch {
+			copyBatch(src, dst, keys, overwrite, &s)
+			keys = keys[:0]
+		}
+	}
+	if len(keys) > 0 {
+		copyBatch(src, dst, keys, overwrite, &s)
+	}
+	return s, it.Err()
+}
+
+// copyBatch reads the entries concurrently, and writes them with a single pipeline
+// Entries that expired or were deleted since they were dumped are skipped
+func copyBatch(src, dst *client.Client, keys []string, overwrite bool, s *stats) {
+	items := make([]*client.Item, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			// the TimeToLive of the item is the remaining one, ready to be stored as is
+			items[i], errs[i] = src.GetItem(key)
+		}(i, k)
+	}
+	wg.Wait()
+
+	p := dst.Pipeline()
+	queued := make([]string, 0, len(keys))
+	for i, item := range items {
+		switch {
+		case errs[i] != nil:
+			fmt.Fprintf(os.Stderr, "error reading %s: %v\n", keys[i], errs[i])
+			s.failed++
+		case item == nil:
+			s.skipped++
+		case overwrite:
+			p.SetItem(keys[i], *item)
+			queued = append(queued, keys[i])
+		default:
+			p.AddItem(keys[i], *item)
+			queued = append(queued, keys[i])
+		}
+	}
+	for i, r := range p.Exec() {
+		switch {
+		case r.Error != nil:
+			fmt.Fprintf(os.Stderr, "error writing %s: %v\n", queued[i], r.Error)
+			s.failed++
+		case r.Result == client.Success:
+			s.copied++
+		default:
+			s.skipped++
+		}
+	}
+}
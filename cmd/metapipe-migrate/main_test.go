@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	client "github.com/jsp-lqk/metapipe-memcached"
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient(t *testing.T) *client.Client {
+	s, err := memcachedtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	c, err := client.DefaultClient(s.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Shutdown)
+	return &c
+}
+
+func TestMigrate(t *testing.T) {
+	src, dst := testClient(t), testClient(t)
+	for k, item := range map[string]client.Item{
+		"expiring":  {Value: []byte("a"), Flags: 3, TimeToLive: 100},
+		"permanent": {Value: []byte("b")},
+		"existing":  {Value: []byte("old")},
+	} {
+		if _, err := src.SetItem(k, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dst.Set("existing", []byte("new"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := migrate(src, dst, client.DumpAll, 2, false)
+	assert.NoError(t, err)
+	assert.Equal(t, stats{copied: 2, skipped: 1}, s, "Expected the existing entry to be skipped")
+
+	item, err := dst.GetItem("expiring")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), item.Value)
+	assert.Equal(t, uint32(3), item.Flags, "Expected flags to be copied")
+	assert.InDelta(t, 100, item.TimeToLive, 2, "Expected the remaining TTL to be copied")
+	item, err = dst.GetItem("permanent")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, item.TimeToLive, "Expected entries without TTL to be copied without TTL")
+	v, err := dst.Get("existing")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), v, "Expected the existing entry to be kept")
+
+	s, err = migrate(src, dst, client.DumpAll, 100, true)
+	assert.NoError(t, err)
+	assert.Equal(t, stats{copied: 3}, s)
+	v, err = dst.Get("existing")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old"), v, "Expected the existing entry to be overwritten")
+}
+
+func TestCopyBatchSkipsMissingEntries(t *testing.T) {
+	src, dst := testClient(t), testClient(t)
+	if _, err := src.Set("present", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var s stats
+	copyBatch(src, dst, []string{"present", "deleted"}, false, &s)
+	assert.Equal(t, stats{copied: 1, skipped: 1}, s, "Expected entries gone since the dump to be skipped")
+	item, err := dst.GetItem("deleted")
+	assert.NoError(t, err)
+	assert.Nil(t, item, "Expected the deleted entry not to be added")
+}
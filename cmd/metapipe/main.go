@@ -0,0 +1,174 @@
+// Command metapipe runs single operations against memcached servers, for debugging
+//
+// Usage:
+//
+//	metapipe [-servers host:port,host:port] <command> [arguments]
+//
+// Commands:
+//
+//	get <key>                  prints the value of an entry
+//	set <key> <value> [ttl]    stores an entry
+//	delete <key>               deletes an entry
+//	touch <key> <ttl>          updates the time to live of an entry
+//	info <key>                 prints the metadata of an entry
+//	stats [section]            prints the statistics of every server
+//	route <key>                prints the server the key is routed to
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	client "github.com/jsp-lqk/metapipe-memcached"
+)
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	servers := flag.String("servers", "127.0.0.1:11211", "comma separated servers, host:port")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: metapipe [-servers host:port,...] get|set|delete|touch|info|stats|route [arguments]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := client.DefaultClient(strings.Split(*servers, ",")...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting: %v\n", err)
+		os.Exit(1)
+	}
+	err = run(&c, flag.Arg(0), flag.Args()[1:])
+	c.Shutdown()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(c *client.Client, command string, args []string) error {
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+		v, err := c.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return errors.New("not found")
+		}
+		fmt.Println(string(v))
+	case "set":
+		if len(args) != 2 && len(args) != 3 {
+			return errUsage
+		}
+		ttl := 0
+		if len(args) == 3 {
+			var err error
+			if ttl, err = strconv.Atoi(args[2]); err != nil {
+				return fmt.Errorf("%w: ttl %s", errUsage, args[2])
+			}
+		}
+		return mutation(c.Set(args[0], []byte(args[1]), ttl))
+	case "delete":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return mutation(c.Delete(args[0]))
+	case "touch":
+		if len(args) != 2 {
+			return errUsage
+		}
+		ttl, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("%w: ttl %s", errUsage, args[1])
+		}
+		return mutation(c.Touch(args[0], ttl))
+	case "info":
+		if len(args) != 1 {
+			return errUsage
+		}
+		i, err := c.Info(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ttl %d\nlast access %d\ncas %d\nfetched %t\nslab class %d\nsize %d\n",
+			i.TimeToLive, i.LastAccess, i.CasId, i.Fetched, i.SlabClassId, i.Size)
+	case "stats":
+		if len(args) > 1 {
+			return errUsage
+		}
+		section := ""
+		if len(args) == 1 {
+			section = args[0]
+		}
+		stats, err := c.StatsFor(section)
+		printStats(stats)
+		return err
+	case "route":
+		if len(args) != 1 {
+			return errUsage
+		}
+		server, err := c.Server(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(server)
+	default:
+		return fmt.Errorf("%w: unknown command", errUsage)
+	}
+	return nil
+}
+
+// mutation prints the result of a mutation, failing unless it succeeded
+func mutation(r client.MutationResult, err error) error {
+	if err != nil {
+		return err
+	}
+	switch r {
+	case client.Success:
+		fmt.Println("ok")
+		return nil
+	case client.NotFound:
+		return errors.New("not found")
+	case client.NotStored:
+		return errors.New("not stored")
+	case client.Exists:
+		return errors.New("exists")
+	default:
+		return errors.New("failed")
+	}
+}
+
+// printStats prints the statistics sorted by server and name
+func printStats(stats map[string]map[string]string) {
+	servers := make([]string, 0, len(stats))
+	for server := range stats {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		names := make([]string, 0, len(stats[server]))
+		for name := range stats[server] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s %s %s\n", server, name, stats[server][name])
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Defaults of the zero fields of a ConnectionTarget
+const (
+	DefaultMaxOutstandingRequests = 1000
+	DefaultTimeoutMs              = 1000
+	DefaultDialTimeoutMs          = 1000
+	DefaultReadTimeoutMs          = 5000
+	DefaultWriteTimeoutMs         = 5000
+	DefaultPoolSize               = 1
+	DefaultBufferSize             = 4096
+)
+
+// A Logger receives the messages about connection problems, log.Logger is one
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
+
+// loggerOf returns the logger of the target of a client, unwrapping it if needed
+// Clients without a target log to the standard output
+func loggerOf(mc MemcacheClient) Logger {
+	for {
+		if ic, ok := mc.(*InnerMetaClient); ok {
+			return ic.target.Logger
+		}
+		u, ok := mc.(interface{ Unwrap() MemcacheClient })
+		if !ok {
+			return stdoutLogger{}
+		}
+		mc = u.Unwrap()
+	}
+}
+
+// Metrics receives measurements about the connections to a server
+// Its methods are called from the goroutines of the connections, so they must not block
+type Metrics interface {
+	// Response is called for every response, with the command it answers, e.g. mg, and its latency
+	Response(server string, command string, latency time.Duration, err error)
+	// Connect is called for every connection attempt, err being nil if it succeeded
+	Connect(server string, err error)
+}
+
+// withDefaults validates the target, replacing its zero fields with their defaults
+func (t ConnectionTarget) withDefaults() (ConnectionTarget, error) {
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"port", t.Port},
+		{"max outstanding requests", t.MaxOutstandingRequests},
+		{"timeout", t.TimeoutMs},
+		{"dial timeout", t.DialTimeoutMs},
+		{"read timeout", t.ReadTimeoutMs},
+		{"write timeout", t.WriteTimeoutMs},
+		{"keepalive", t.KeepAliveMs},
+		{"health check interval", t.HealthCheckIntervalMs},
+		{"health check failures", t.HealthCheckFailures},
+		{"pool size", t.PoolSize},
+		{"read buffer size", t.ReadBufferSize},
+		{"write buffer size", t.WriteBufferSize},
+	} {
+		if f.value < 0 {
+			return t, fmt.Errorf("%w: negative %s %d", ErrInvalidOption, f.name, f.value)
+		}
+	}
+	if t.Port > 65535 {
+		return t, fmt.Errorf("%w: port %d is out of range", ErrInvalidOption, t.Port)
+	}
+	if t.CircuitBreaker != nil {
+		if err := t.CircuitBreaker.validate(); err != nil {
+			return t, err
+		}
+	}
+	defaults := []struct {
+		field *int
+		value int
+	}{
+		{&t.MaxOutstandingRequests, DefaultMaxOutstandingRequests},
+		{&t.TimeoutMs, DefaultTimeoutMs},
+		{&t.DialTimeoutMs, DefaultDialTimeoutMs},
+		{&t.ReadTimeoutMs, DefaultReadTimeoutMs},
+		{&t.WriteTimeoutMs, DefaultWriteTimeoutMs},
+		{&t.PoolSize, DefaultPoolSize},
+		{&t.ReadBufferSize, DefaultBufferSize},
+		{&t.WriteBufferSize, DefaultBufferSize},
+	}
+	for _, d := range defaults {
+		if *d.field == 0 {
+			*d.field = d.value
+		}
+	}
+	if t.Logger == nil {
+		t.Logger = stdoutLogger{}
+	}
+	return t, nil
+}
+
+// dial opens a connection to the server of the target, over TLS if configured
+func (t ConnectionTarget) dial() (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(t.DialTimeoutMs) * time.Millisecond,
+		KeepAlive: time.Duration(t.KeepAliveMs) * time.Millisecond,
+	}
+	address := net.JoinHostPort(t.Address, strconv.Itoa(t.Port))
+	if t.TLS != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: t.TLS}).Dial("tcp", address)
+	}
+	return dialer.Dial("tcp", address)
+}
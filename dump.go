@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DumpMode selects the entries enumerated by the LRU crawler
+type DumpMode string
+
+const (
+	// DumpAll walks the LRUs of every slab class
+	DumpAll DumpMode = "all"
+	// DumpHash walks the hash table, so that every entry is seen exactly once
+	DumpHash DumpMode = "hash"
+)
+
+// KeyEntry is an entry enumerated by the LRU crawler
+// Expiration is -1 for entries that never expire, and a unix timestamp otherwise, as is LastAccess
+type KeyEntry struct {
+	Server      string
+	Key         string
+	Expiration  int64
+	LastAccess  int64
+	CasId       uint64
+	Fetched     bool
+	SlabClassId int
+	Size        int
+}
+
+type dumpSource struct {
+	server        string
+	open          func() (net.Conn, error)
+	readTimeoutMs int
+}
+
+// A KeyIterator streams the entries dumped by the servers, one server after another
+// Iterate with Next, reading each entry with Entry, and check Err once done
+// Closing the iterator before it's exhausted releases its connection
+type KeyIterator struct {
+	pending       []dumpSource
+	server        string
+	conn          net.Conn
+	reader        *bufio.Reader
+	readTimeoutMs int
+	entry         KeyEntry
+	err           error
+}
+
+// DumpKeys enumerates the keys of the server with the LRU crawler, over a dedicated connection
+func (c *InnerMetaClient) DumpKeys(mode DumpMode) *KeyIterator {
+	return &KeyIterator{pending: []dumpSource{c.dumpSource(mode)}}
+}
+
+func (c *InnerMetaClient) dumpSource(mode DumpMode) dumpSource {
+	return dumpSource{server: c.Address(), readTimeoutMs: c.target.ReadTimeoutMs, open: func() (net.Conn, error) {
+		if mode != DumpAll && mode != DumpHash {
+			return nil, fmt.Errorf("invalid dump mode: %q", mode)
+		}
+		conn, err := c.target.dial()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(conn, "lru_crawler metadump %s\r\n", mode); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}}
+}
+
+// DumpKeys enumerates the keys of every server with the LRU crawler, one server after another
+func (c *Client) DumpKeys(mode DumpMode) *KeyIterator {
+	if err := c.allowed(OpDump); err != nil {
+		return &KeyIterator{err: err}
+	}
+	clients, err := c.clients()
+	if err != nil {
+		return &KeyIterator{err: err}
+	}
+	it := &KeyIterator{}
+	for _, mc := range clients {
+		s, ok := serverClient(mc)
+		if !ok {
+			err := fmt.Errorf("%w: %T does not support server commands", ErrNotSupported, mc)
+			it.pending = append(it.pending, dumpSource{open: func() (net.Conn, error) { return nil, err }})
+			continue
+		}
+		it.pending = append(it.pending, s.DumpKeys(mode).pending...)
+	}
+	return it
+}
+
+// Next advances to the next entry, returning false once every server is exhausted or on error
+func (it *KeyIterator) Next() bool {
+	for it.err == nil {
+		if it.reader == nil {
+			if len(it.pending) == 0 {
+				return false
+			}
+			source := it.pending[0]
+			it.pending = it.pending[1:]
+			conn, err := source.open()
+			if err != nil {
+				it.fail(source.server, err)
+				return false
+			}
+			it.server = source.server
+			it.conn = conn
+			it.reader = bufio.NewReader(conn)
+			it.readTimeoutMs = source.readTimeoutMs
+		}
+		if it.readTimeoutMs > 0 {
+			// a server that stops streaming fails the iteration instead of blocking it forever
+			it.conn.SetReadDeadline(time.Now().Add(time.Duration(it.readTimeoutMs) * time.Millisecond))
+		}
+		line, err := it.reader.ReadString('\n')
+		if err != nil {
+			it.fail(it.server, err)
+			return false
+		}
+		line = strings.TrimSpace(line)
+		if line == "END" {
+			it.closeConn()
+			continue
+		}
+		entry, err := parseKeyEntry(line)
+		if err != nil {
+			it.fail(it.server, err)
+			return false
+		}
+		entry.Server = it.server
+		it.entry = entry
+		return true
+	}
+	return false
+}
+
+// Entry returns the current entry
+func (it *KeyIterator) Entry() KeyEntry {
+	return it.entry
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration, releasing its connection
+func (it *KeyIterator) Close() error {
+	it.pending = nil
+	return it.closeConn()
+}
+
+func (it *KeyIterator) fail(server string, err error) {
+	it.closeConn()
+	it.pending = nil
+	it.err = fmt.Errorf("server %s: %w", server, err)
+}
+
+func (it *KeyIterator) closeConn() error {
+	it.reader = nil
+	if it.conn == nil {
+		return nil
+	}
+	err := it.conn.Close()
+	it.conn = nil
+	return err
+}
+
+// parseKeyEntry parses a metadump line, such as
+// key=foo exp=-1 la=1700000000 cas=12 fetch=no cls=1 size=63
+func parseKeyEntry(line string) (KeyEntry, error) {
+	var entry KeyEntry
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "key=") {
+		return entry, fmt.Errorf("invalid response: %s", line)
+	}
+	for _, field := range fields {
+		name, value, _ := strings.Cut(field, "=")
+		var err error
+		switch name {
+		case "key":
+			entry.Key, err = url.QueryUnescape(value)
+		case "exp":
+			entry.Expiration, err = strconv.ParseInt(value, 10, 64)
+		case "la":
+			entry.LastAccess, err = strconv.ParseInt(value, 10, 64)
+		case "cas":
+			entry.CasId, err = strconv.ParseUint(value, 10, 64)
+		case "fetch":
+			entry.Fetched = value == "yes"
+		case "cls":
+			entry.SlabClassId, err = strconv.Atoi(value)
+		case "size":
+			entry.Size, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return entry, fmt.Errorf("invalid %s in %s: %w", name, line, err)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyEntry(t *testing.T) {
+	entry, err := parseKeyEntry("key=user%3A42 exp=-1 la=1700000000 cas=12 fetch=yes cls=1 size=63")
+	assert.NoError(t, err)
+	assert.Equal(t, KeyEntry{Key: "user:42", Expiration: -1, LastAccess: 1700000000, CasId: 12, Fetched: true, SlabClassId: 1, Size: 63}, entry)
+
+	_, err = parseKeyEntry("BUSY currently processing crawler request")
+	assert.Error(t, err, "Expected busy crawler to fail")
+	_, err = parseKeyEntry("key=a exp=never")
+	assert.Error(t, err, "Expected invalid expiration to fail")
+}
+
+func TestDumpKeys(t *testing.T) {
+	first, err := NewInnerMetaClient(fakeTarget(fakeMemcached(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewInnerMetaClient(fakeTarget(fakeMemcached(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "b"} {
+		if _, err := first.Set(k, []byte("value"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := second.Set("c", []byte("value"), 100); err != nil {
+		t.Fatal(err)
+	}
+	c := Client{router: &ShardedRouter{clients: []MemcacheClient{first, second}}}
+	defer c.Shutdown()
+
+	it := c.DumpKeys(DumpAll)
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Entry().Key)
+	}
+	assert.NoError(t, it.Err())
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, keys, "Expected the keys of every server")
+	assert.NoError(t, it.Close())
+
+	it = c.DumpKeys("everything")
+	assert.False(t, it.Next(), "Expected invalid mode to fail")
+	assert.Error(t, it.Err())
+
+	ro := c.Deny(OpDump)
+	it = ro.DumpKeys(DumpHash)
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), ErrOperationNotAllowed)
+}
+
+func TestDumpKeysReadTimeout(t *testing.T) {
+	s := fakeMemcached(t)
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "lru_crawler metadump") {
+			return memcachedtest.Action{Delay: time.Second}
+		}
+		return memcachedtest.Action{}
+	})
+	target := fakeTarget(s)
+	target.ReadTimeoutMs = 100
+	c, err := SingleTargetClient(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	start := time.Now()
+	it := c.DumpKeys(DumpAll)
+	assert.False(t, it.Next(), "Expected a stalled dump to fail")
+	assert.Error(t, it.Err())
+	assert.Less(t, time.Since(start), time.Second, "Expected the read deadline to fail the dump")
+	assert.NoError(t, it.Close())
+}
@@ -0,0 +1,163 @@
+package client
+
+import "errors"
+
+// ErrNotSupported is returned for operations that the MemcacheClient of the key doesn't implement
+var ErrNotSupported = errors.New("operation not supported by client")
+
+// A Recacher is a MemcacheClient supporting stale-while-revalidate, see Client.Invalidate
+type Recacher interface {
+	GetRecache(key string, recacheTtl int) (RecacheResult, error)
+	Invalidate(key string, ttl int) (MutationResult, error)
+}
+
+// A MetadataGetter is a MemcacheClient that gets entries along with their metadata
+type MetadataGetter interface {
+	GetEx(key string, opts GetOptions) (GetResult, error)
+}
+
+// An ItemClient is a MemcacheClient that stores and gets entries along with their client flags
+// Items without flags are stored with the plain operations of clients that aren't ItemClients
+type ItemClient interface {
+	AddItem(key string, item Item) (MutationResult, error)
+	GetItem(key string) (*Item, error)
+	ReplaceItem(key string, item Item) (MutationResult, error)
+	SetItem(key string, item Item) (MutationResult, error)
+}
+
+// An Appender is a MemcacheClient that can append and prepend data to the value of entries
+type Appender interface {
+	Append(key string, value []byte) (MutationResult, error)
+	AppendOrCreate(key string, value []byte, ttl int) (MutationResult, error)
+	Prepend(key string, value []byte) (MutationResult, error)
+	PrependOrCreate(key string, value []byte, ttl int) (MutationResult, error)
+}
+
+// An AtomicGetter is a MemcacheClient that can get and modify an entry in a single round trip
+type AtomicGetter interface {
+	GetAndDelete(key string) ([]byte, error)
+	GetAndTouch(key string, ttl int) ([]byte, error)
+}
+
+// A QuietClient is a MemcacheClient that can send mutations without waiting for the response
+// Clients that aren't QuietClients run the regular mutations instead, waiting for their response
+type QuietClient interface {
+	DeleteNoReply(key string) error
+	SetNoReply(key string, value []byte, ttl int) error
+}
+
+func addItem(s MemcacheClient, key string, item Item) (MutationResult, error) {
+	if ic, ok := s.(ItemClient); ok {
+		return ic.AddItem(key, item)
+	}
+	if item.Flags == 0 {
+		return s.Add(key, item.Value, item.TimeToLive)
+	}
+	return Error, ErrNotSupported
+}
+
+func getItem(s MemcacheClient, key string) (*Item, error) {
+	if ic, ok := s.(ItemClient); ok {
+		return ic.GetItem(key)
+	}
+	return nil, ErrNotSupported
+}
+
+func replaceItem(s MemcacheClient, key string, item Item) (MutationResult, error) {
+	if ic, ok := s.(ItemClient); ok {
+		return ic.ReplaceItem(key, item)
+	}
+	if item.Flags == 0 {
+		return s.Replace(key, item.Value, item.TimeToLive)
+	}
+	return Error, ErrNotSupported
+}
+
+func setItem(s MemcacheClient, key string, item Item) (MutationResult, error) {
+	if ic, ok := s.(ItemClient); ok {
+		return ic.SetItem(key, item)
+	}
+	if item.Flags == 0 {
+		return s.Set(key, item.Value, item.TimeToLive)
+	}
+	return Error, ErrNotSupported
+}
+
+func getRecache(s MemcacheClient, key string, recacheTtl int) (RecacheResult, error) {
+	if r, ok := s.(Recacher); ok {
+		return r.GetRecache(key, recacheTtl)
+	}
+	return RecacheResult{}, ErrNotSupported
+}
+
+func invalidate(s MemcacheClient, key string, ttl int) (MutationResult, error) {
+	if r, ok := s.(Recacher); ok {
+		return r.Invalidate(key, ttl)
+	}
+	return Error, ErrNotSupported
+}
+
+func getEx(s MemcacheClient, key string, opts GetOptions) (GetResult, error) {
+	if m, ok := s.(MetadataGetter); ok {
+		return m.GetEx(key, opts)
+	}
+	return GetResult{}, ErrNotSupported
+}
+
+func appendTo(s MemcacheClient, key string, value []byte) (MutationResult, error) {
+	if a, ok := s.(Appender); ok {
+		return a.Append(key, value)
+	}
+	return Error, ErrNotSupported
+}
+
+func appendOrCreate(s MemcacheClient, key string, value []byte, ttl int) (MutationResult, error) {
+	if a, ok := s.(Appender); ok {
+		return a.AppendOrCreate(key, value, ttl)
+	}
+	return Error, ErrNotSupported
+}
+
+func prepend(s MemcacheClient, key string, value []byte) (MutationResult, error) {
+	if a, ok := s.(Appender); ok {
+		return a.Prepend(key, value)
+	}
+	return Error, ErrNotSupported
+}
+
+func prependOrCreate(s MemcacheClient, key string, value []byte, ttl int) (MutationResult, error) {
+	if a, ok := s.(Appender); ok {
+		return a.PrependOrCreate(key, value, ttl)
+	}
+	return Error, ErrNotSupported
+}
+
+func getAndDelete(s MemcacheClient, key string) ([]byte, error) {
+	if a, ok := s.(AtomicGetter); ok {
+		return a.GetAndDelete(key)
+	}
+	return nil, ErrNotSupported
+}
+
+func getAndTouch(s MemcacheClient, key string, ttl int) ([]byte, error) {
+	if a, ok := s.(AtomicGetter); ok {
+		return a.GetAndTouch(key, ttl)
+	}
+	return nil, ErrNotSupported
+}
+
+func deleteNoReply(s MemcacheClient, key string) error {
+	if q, ok := s.(QuietClient); ok {
+		return q.DeleteNoReply(key)
+	}
+	_, err := s.Delete(key)
+	return err
+}
+
+func setNoReply(s MemcacheClient, key string, value []byte, ttl int) error {
+	if q, ok := s.(QuietClient); ok {
+		return q.SetNoReply(key, value, ttl)
+	}
+	_, err := s.Set(key, value, ttl)
+	return err
+}
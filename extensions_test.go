@@ -0,0 +1,47 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plainClient only implements MemcacheClient, hiding the optional interfaces of the wrapped client
+type plainClient struct {
+	MemcacheClient
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	c := Client{router: NewDirectRouter(plainClient{NewInMemoryClient(nil)})}
+	defer c.Shutdown()
+
+	_, err := c.GetRecache("key", 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.Invalidate("key", 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.GetEx("key", GetOptions{Value: true})
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	r, err := c.SetItem("key", Item{Value: []byte("value")})
+	assert.NoError(t, err, "Expected item without flags to fall back to a plain store")
+	assert.Equal(t, Success, r)
+	_, err = c.SetItem("key", Item{Value: []byte("value"), Flags: 1})
+	assert.ErrorIs(t, err, ErrNotSupported, "Expected flags to be refused")
+	_, err = c.GetItem("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.Append("key", []byte("more"))
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = c.GetAndTouch("key", 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	assert.NoError(t, c.SetNoReply("quiet", []byte("value"), 0), "Expected quiet store to fall back to a store")
+	v, err := c.Get("quiet")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v)
+
+	// unsupported operations never reach the server, so they don't open the circuit
+	cb := NewCircuitBreaker(plainClient{NewInMemoryClient(nil)}, CircuitBreakerSettings{FailureRate: 0.5, MinRequests: 1, WindowMs: 1000, OpenMs: 1000})
+	_, err = cb.GetRecache("key", 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.Equal(t, Closed, cb.State())
+}
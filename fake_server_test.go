@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+)
+
+func fakeMemcached(t *testing.T) *memcachedtest.Server {
+	s, err := memcachedtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func fakeTarget(s *memcachedtest.Server) ConnectionTarget {
+	return ConnectionTarget{Address: s.Host(), Port: s.Port(), MaxOutstandingRequests: 10, TimeoutMs: 1000}
+}
+
+// TestFakeServer runs the integration tests against the in-memory server, so they run without Docker
+func TestFakeServer(t *testing.T) {
+	s := fakeMemcached(t)
+	host, port := s.Host(), s.Port()
+
+	simpleGetsAndSets(t, host, port)
+	allOtherOperations(t, host, port)
+	staleWhileRevalidate(t, host, port)
+	getWithMetadata(t, host, port)
+	itemsWithFlags(t, host, port)
+	appendAndPrepend(t, host, port)
+	getAndTouchAndDelete(t, host, port)
+	binaryKeys(t, host, port)
+	noReplyMutations(t, host, port)
+	pipelines(t, host, port)
+	asyncOperations(t, host, port)
+	// triggerMaxConcurrent is left out, as it depends on the timing of a real server
+
+	// slow the server down, so that requests pile up
+	s.SetHook(func(command string) memcachedtest.Action {
+		return memcachedtest.Action{Delay: time.Millisecond}
+	})
+	triggerTimeout(t, host, port)
+}
+
+// TestFakeShardedServers runs the sharded integration tests against in-memory servers
+func TestFakeShardedServers(t *testing.T) {
+	servers := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		servers = append(servers, fakeMemcached(t).Address())
+	}
+	shardedTest(t, servers)
+	shardedBulkMutations(t, servers)
+	shardedStats(t, servers)
+	shardedAdmin(t, servers)
+	shardedDumpKeys(t, servers)
+}
@@ -0,0 +1,119 @@
+package client
+
+import "sync"
+
+// A Future is the result of an operation that was sent without waiting for its response
+type Future[T any] struct {
+	once    sync.Once
+	resolve func() (T, error)
+	value   T
+	err     error
+}
+
+func newFuture[T any](resolve func() (T, error)) *Future[T] {
+	return &Future[T]{resolve: resolve}
+}
+
+// goFuture runs fn in its own goroutine, for clients that can't send operations asynchronously
+func goFuture[T any](fn func() (T, error)) *Future[T] {
+	done := make(chan struct{})
+	var value T
+	var err error
+	go func() {
+		defer close(done)
+		value, err = fn()
+	}()
+	return newFuture(func() (T, error) {
+		<-done
+		return value, err
+	})
+}
+
+func failedFuture[T any](err error) *Future[T] {
+	return newFuture(func() (T, error) {
+		var zero T
+		return zero, err
+	})
+}
+
+// Wait blocks until the response of the operation is available, and returns its result
+// It can be called many times, and from many goroutines
+func (f *Future[T]) Wait() (T, error) {
+	f.once.Do(func() {
+		f.value, f.err = f.resolve()
+		f.resolve = nil
+	})
+	return f.value, f.err
+}
+
+// An AsyncClient is a MemcacheClient that can send operations without waiting for their responses
+type AsyncClient interface {
+	DeleteAsync(key string) *Future[MutationResult]
+	GetAsync(key string) *Future[[]byte]
+	SetAsync(key string, value []byte, ttl int) *Future[MutationResult]
+	TouchAsync(key string, ttl int) *Future[MutationResult]
+}
+
+// Deletes an entry without waiting for the response
+func (c *Client) DeleteAsync(key string) *Future[MutationResult] {
+	if err := c.allowed(OpDelete); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	s := c.route(key, OpDelete)
+	return deleteAsync(s, key)
+}
+
+// Gets the contents of an entry without waiting for the response
+func (c *Client) GetAsync(key string) *Future[[]byte] {
+	if err := c.allowed(OpGet); err != nil {
+		return failedFuture[[]byte](err)
+	}
+	s := c.route(key, OpGet)
+	return getAsync(s, key)
+}
+
+// Stores an entry without waiting for the response
+func (c *Client) SetAsync(key string, value []byte, ttl int) *Future[MutationResult] {
+	if err := c.allowed(OpSet); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	s := c.route(key, OpSet)
+	return setAsync(s, key, value, ttl)
+}
+
+// Updates the time to live of an entry without waiting for the response
+func (c *Client) TouchAsync(key string, ttl int) *Future[MutationResult] {
+	if err := c.allowed(OpTouch); err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	s := c.route(key, OpTouch)
+	return touchAsync(s, key, ttl)
+}
+
+func deleteAsync(s MemcacheClient, key string) *Future[MutationResult] {
+	if a, ok := s.(AsyncClient); ok {
+		return a.DeleteAsync(key)
+	}
+	return goFuture(func() (MutationResult, error) { return s.Delete(key) })
+}
+
+func getAsync(s MemcacheClient, key string) *Future[[]byte] {
+	if a, ok := s.(AsyncClient); ok {
+		return a.GetAsync(key)
+	}
+	return goFuture(func() ([]byte, error) { return s.Get(key) })
+}
+
+func setAsync(s MemcacheClient, key string, value []byte, ttl int) *Future[MutationResult] {
+	if a, ok := s.(AsyncClient); ok {
+		return a.SetAsync(key, value, ttl)
+	}
+	return goFuture(func() (MutationResult, error) { return s.Set(key, value, ttl) })
+}
+
+func touchAsync(s MemcacheClient, key string, ttl int) *Future[MutationResult] {
+	if a, ok := s.(AsyncClient); ok {
+		return a.TouchAsync(key, ttl)
+	}
+	return goFuture(func() (MutationResult, error) { return s.Touch(key, ttl) })
+}
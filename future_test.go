@@ -0,0 +1,116 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFutures(t *testing.T) {
+	calls := 0
+	f := newFuture(func() (int, error) {
+		calls++
+		return 42, nil
+	})
+	for i := 0; i < 3; i++ {
+		v, err := f.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+	}
+	assert.Equal(t, 1, calls, "Expected the result to be resolved once")
+
+	v, err := goFuture(func() (string, error) { return "value", nil }).Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	boom := errors.New("boom")
+	_, err = failedFuture[[]byte](boom).Wait()
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestAsyncFallback(t *testing.T) {
+	inner := &flakyClient{err: ErrRequestTimeout}
+	c := Client{router: &DirectRouter{client: inner}}
+
+	_, err := c.GetAsync("key").Wait()
+	assert.ErrorIs(t, err, ErrRequestTimeout, "Expected the error of the synchronous client")
+	assert.Equal(t, 1, inner.calls)
+
+	ro := c.AllowOnly(ReadOperations)
+	_, err = ro.SetAsync("key", []byte("value"), 0).Wait()
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected set to be refused")
+}
+
+type asyncStub struct {
+	*flakyClient
+	async int
+}
+
+func (a *asyncStub) DeleteAsync(key string) *Future[MutationResult] {
+	a.async++
+	return failedFuture[MutationResult](a.err)
+}
+
+func (a *asyncStub) GetAsync(key string) *Future[[]byte] {
+	a.async++
+	return failedFuture[[]byte](a.err)
+}
+
+func (a *asyncStub) SetAsync(key string, value []byte, ttl int) *Future[MutationResult] {
+	a.async++
+	return failedFuture[MutationResult](a.err)
+}
+
+func (a *asyncStub) TouchAsync(key string, ttl int) *Future[MutationResult] {
+	a.async++
+	return failedFuture[MutationResult](a.err)
+}
+
+func TestCircuitBreakerAsync(t *testing.T) {
+	inner := &asyncStub{flakyClient: &flakyClient{err: ErrRequestTimeout}}
+	cb := NewCircuitBreaker(inner, CircuitBreakerSettings{FailureRate: 0.5, MinRequests: 2, WindowMs: 1000, OpenMs: 1000})
+	c := Client{router: &DirectRouter{client: cb}}
+
+	f := c.GetAsync("key")
+	assert.Equal(t, Closed, cb.State(), "Expected the result to be recorded when the future resolves")
+	_, err := f.Wait()
+	assert.ErrorIs(t, err, ErrRequestTimeout)
+	_, err = c.SetAsync("key", []byte("value"), 0).Wait()
+	assert.ErrorIs(t, err, ErrRequestTimeout)
+	assert.Equal(t, 2, inner.async, "Expected the asynchronous operations of the wrapped client")
+	assert.Equal(t, 0, inner.calls, "Expected no synchronous fallback")
+	assert.Equal(t, Open, cb.State(), "Expected failed futures to open the circuit")
+
+	_, err = c.DeleteAsync("key").Wait()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, inner.async)
+}
+
+func TestAsyncOrdering(t *testing.T) {
+	c, err := SingleTargetClient(fakeTarget(fakeMemcached(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	for i := 0; i < 20; i++ {
+		first := c.SetAsync("key", []byte("1"), 0)
+		second := c.SetAsync("key", []byte("2"), 0)
+		_, err := first.Wait()
+		assert.NoError(t, err)
+		_, err = second.Wait()
+		assert.NoError(t, err)
+		v, err := c.Get("key")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("2"), v, "Expected the writes to be sent in the order they were issued")
+
+		async := c.SetAsync("quiet", []byte("async"), 0)
+		assert.NoError(t, c.SetNoReply("quiet", []byte("quiet"), 0))
+		_, err = async.Wait()
+		assert.NoError(t, err)
+		v, err = c.Get("quiet")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("quiet"), v, "Expected the quiet write to be sent after the async one")
+	}
+}
@@ -0,0 +1,395 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// InMemoryClient is a MemcacheClient keeping its entries in memory, to test code using a Client
+// without a server. It follows the semantics of memcached, TTLs included, on an injectable clock.
+type InMemoryClient struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*memoryEntry
+	cas     int
+}
+
+type memoryEntry struct {
+	value   []byte
+	flags   uint32
+	exp     time.Time
+	cas     int
+	access  time.Time
+	fetched bool
+	stale   bool
+	won     bool
+}
+
+// Creates an InMemoryClient using now as its clock, time.Now if nil
+// To use it through a Client, route to it with NewClient(NewDirectRouter(c))
+func NewInMemoryClient(now func() time.Time) *InMemoryClient {
+	if now == nil {
+		now = time.Now
+	}
+	return &InMemoryClient{now: now, entries: make(map[string]*memoryEntry)}
+}
+
+// lookup returns the live entry of a key, with the mutex held
+func (c *InMemoryClient) lookup(key string, now time.Time) *memoryEntry {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.exp.IsZero() && !now.Before(e.exp) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e
+}
+
+// expiration turns a TTL into an expiration time, TTLs over 30 days being unix timestamps
+func expiration(ttl int, now time.Time) time.Time {
+	switch {
+	case ttl == 0:
+		return time.Time{}
+	case ttl < 0:
+		return now
+	case ttl > maxRelativeTtl:
+		return time.Unix(int64(ttl), 0)
+	default:
+		return now.Add(time.Duration(ttl) * time.Second)
+	}
+}
+
+// remaining returns the remaining TTL of an entry, -1 if it doesn't expire
+func (e *memoryEntry) remaining(now time.Time) int {
+	if e.exp.IsZero() {
+		return -1
+	}
+	return int((e.exp.Sub(now) + time.Second - 1) / time.Second)
+}
+
+// do runs fn on the entry of a valid key, nil if there's none, with the mutex held
+func (c *InMemoryClient) do(key string, fn func(e *memoryEntry, now time.Time)) error {
+	if _, _, err := encodeKey(key, false); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	fn(c.lookup(key, now), now)
+	return nil
+}
+
+func (c *InMemoryClient) store(key string, item Item, now time.Time) {
+	c.cas++
+	c.entries[key] = &memoryEntry{
+		value:  append([]byte{}, item.Value...),
+		flags:  item.Flags,
+		exp:    expiration(item.TimeToLive, now),
+		cas:    c.cas,
+		access: now,
+	}
+}
+
+// fetch returns a copy of the value of an entry, marking it as fetched
+func (e *memoryEntry) fetch(now time.Time) []byte {
+	e.fetched = true
+	e.access = now
+	return append([]byte{}, e.value...)
+}
+
+func (c *InMemoryClient) Add(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.AddItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InMemoryClient) AddItem(key string, item Item) (MutationResult, error) {
+	r := NotStored
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e == nil {
+			c.store(key, item, now)
+			r = Success
+		}
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) Append(key string, value []byte) (MutationResult, error) {
+	return c.concat(key, value, false, false, 0)
+}
+
+func (c *InMemoryClient) AppendOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.concat(key, value, false, true, ttl)
+}
+
+func (c *InMemoryClient) Prepend(key string, value []byte) (MutationResult, error) {
+	return c.concat(key, value, true, false, 0)
+}
+
+func (c *InMemoryClient) PrependOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.concat(key, value, true, true, ttl)
+}
+
+// concat appends or prepends value to an entry, keeping its flags and TTL
+func (c *InMemoryClient) concat(key string, value []byte, prepend bool, create bool, ttl int) (MutationResult, error) {
+	r := NotStored
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		switch {
+		case e == nil && create:
+			c.store(key, Item{Value: value, TimeToLive: ttl}, now)
+		case e == nil:
+			return
+		case prepend:
+			e.value = append(append([]byte{}, value...), e.value...)
+		default:
+			e.value = append(append([]byte{}, e.value...), value...)
+		}
+		if e != nil {
+			c.cas++
+			e.cas = c.cas
+		}
+		r = Success
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) Delete(key string) (MutationResult, error) {
+	r := NotFound
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			delete(c.entries, key)
+			r = Success
+		}
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) DeleteNoReply(key string) error {
+	_, err := c.Delete(key)
+	return err
+}
+
+func (c *InMemoryClient) Get(key string) ([]byte, error) {
+	var v []byte
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			v = e.fetch(now)
+		}
+	})
+	return v, err
+}
+
+func (c *InMemoryClient) GetAndDelete(key string) ([]byte, error) {
+	var v []byte
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			v = e.fetch(now)
+			delete(c.entries, key)
+		}
+	})
+	return v, err
+}
+
+func (c *InMemoryClient) GetAndTouch(key string, ttl int) ([]byte, error) {
+	var v []byte
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			e.exp = expiration(ttl, now)
+			v = e.fetch(now)
+		}
+	})
+	return v, err
+}
+
+func (c *InMemoryClient) GetEx(key string, opts GetOptions) (GetResult, error) {
+	var r GetResult
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e == nil {
+			return
+		}
+		r.Found = true
+		if opts.Flags {
+			r.Flags = e.flags
+		}
+		if opts.TimeToLive {
+			r.TimeToLive = e.remaining(now)
+		}
+		if opts.CasId {
+			r.CasId = e.cas
+		}
+		if opts.LastAccess {
+			r.LastAccess = int(now.Sub(e.access) / time.Second)
+		}
+		if opts.Size {
+			r.Size = len(e.value)
+		}
+		if opts.HitBefore {
+			r.HitBefore = e.fetched
+		}
+		if opts.Key {
+			r.Key = key
+		}
+		v := e.fetch(now)
+		if opts.Value {
+			r.Value = v
+		}
+	})
+	return r, err
+}
+
+func (c *InMemoryClient) GetItem(key string) (*Item, error) {
+	var item *Item
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e == nil {
+			return
+		}
+		ttl := e.remaining(now)
+		switch {
+		case ttl < 0:
+			ttl = 0
+		case ttl > maxRelativeTtl:
+			ttl = int(e.exp.Unix())
+		}
+		item = &Item{Value: e.fetch(now), Flags: e.flags, TimeToLive: ttl}
+	})
+	return item, err
+}
+
+func (c *InMemoryClient) GetMany(keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		v, err := c.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+func (c *InMemoryClient) GetRecache(key string, recacheTtl int) (RecacheResult, error) {
+	var r RecacheResult
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e == nil {
+			return
+		}
+		ttl := e.remaining(now)
+		if e.stale || (ttl != -1 && ttl < recacheTtl) {
+			r.Won = !e.won
+			r.WinPending = e.won
+			e.won = true
+		}
+		r.Stale = e.stale
+		r.Value = e.fetch(now)
+	})
+	return r, err
+}
+
+func (c *InMemoryClient) Info(key string) (EntryInfo, error) {
+	var i EntryInfo
+	found := false
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e == nil {
+			return
+		}
+		found = true
+		i = EntryInfo{
+			TimeToLive:  e.remaining(now),
+			LastAccess:  int(now.Sub(e.access) / time.Second),
+			CasId:       e.cas,
+			Fetched:     e.fetched,
+			SlabClassId: 1,
+			// the size memcached reports, with its item header
+			Size: 56 + len(key) + 1 + len(e.value) + 2,
+		}
+	})
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	if !found {
+		// like the server, which answers EN to the debug command
+		return EntryInfo{}, fmt.Errorf("invalid response: EN")
+	}
+	return i, nil
+}
+
+func (c *InMemoryClient) Invalidate(key string, ttl int) (MutationResult, error) {
+	r := NotFound
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			e.stale = true
+			e.won = false
+			e.exp = expiration(ttl, now)
+			r = Success
+		}
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) Replace(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.ReplaceItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InMemoryClient) ReplaceItem(key string, item Item) (MutationResult, error) {
+	r := NotStored
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			c.store(key, item, now)
+			r = Success
+		}
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) Set(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.SetItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InMemoryClient) SetItem(key string, item Item) (MutationResult, error) {
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		c.store(key, item, now)
+	})
+	if err != nil {
+		return Error, err
+	}
+	return Success, nil
+}
+
+func (c *InMemoryClient) SetNoReply(key string, value []byte, ttl int) error {
+	_, err := c.Set(key, value, ttl)
+	return err
+}
+
+func (c *InMemoryClient) Touch(key string, ttl int) (MutationResult, error) {
+	r := NotFound
+	err := c.do(key, func(e *memoryEntry, now time.Time) {
+		if e != nil {
+			e.exp = expiration(ttl, now)
+			r = Success
+		}
+	})
+	if err != nil {
+		return Error, err
+	}
+	return r, nil
+}
+
+func (c *InMemoryClient) Shutdown() {}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryClient(t *testing.T) {
+	now := time.Now()
+	m := NewInMemoryClient(func() time.Time { return now })
+	c, err := NewClient(NewDirectRouter(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	r, err := c.Add("key", []byte("value"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Success, r, "Expected missing entry to be added")
+	r, err = c.Add("key", []byte("other"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, NotStored, r, "Expected existing entry not to be added")
+	r, err = c.Replace("missing", []byte("value"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, NotStored, r, "Expected missing entry not to be replaced")
+
+	i, err := c.Info("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, i.TimeToLive, "Expected TTL to match add")
+	assert.False(t, i.Fetched, "Expected entry not to be fetched yet")
+
+	// entries expire with the clock
+	now = now.Add(9 * time.Second)
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v, "Expected entry to be alive")
+	r, err = c.Touch("key", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Success, r, "Expected TTL to be updated")
+	now = now.Add(9 * time.Second)
+	v, err = c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v, "Expected touched entry to be alive")
+	now = now.Add(time.Second)
+	v, err = c.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "Expected entry to expire")
+	r, err = c.Touch("key", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, NotFound, r, "Expected expired entry not to be touched")
+
+	// items keep their flags, and report storable TTLs
+	// TTLs over 30 days are unix timestamps
+	ttl := int(now.Add(60 * 24 * time.Hour).Unix())
+	_, err = c.SetItem("item", Item{Value: []byte("value"), Flags: 7, TimeToLive: ttl})
+	assert.NoError(t, err)
+	item, err := c.GetItem("item")
+	assert.NoError(t, err)
+	assert.Equal(t, &Item{Value: []byte("value"), Flags: 7, TimeToLive: ttl}, item)
+
+	r, err = c.Append("item", []byte("-appended"))
+	assert.NoError(t, err)
+	assert.Equal(t, Success, r)
+	gr, err := c.GetEx("item", GetOptions{Value: true, Flags: true, HitBefore: true})
+	assert.NoError(t, err)
+	assert.Equal(t, GetResult{Found: true, Value: []byte("value-appended"), Flags: 7, HitBefore: true}, gr)
+
+	// stale while revalidate
+	r, err = c.Invalidate("item", 30)
+	assert.NoError(t, err)
+	assert.Equal(t, Success, r)
+	rr, err := c.GetRecache("item", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, RecacheResult{Value: []byte("value-appended"), Won: true, Stale: true}, rr)
+	rr, err = c.GetRecache("item", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, RecacheResult{Value: []byte("value-appended"), Stale: true, WinPending: true}, rr)
+
+	_, err = c.Set("with space", []byte("value"), 0)
+	assert.ErrorIs(t, err, ErrInvalidKey, "Expected invalid key to be rejected")
+}
@@ -3,13 +3,20 @@ package client
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Request struct {
 	responseChannel chan Response
+	opaque          string
+	command         string
+	sent            time.Time
+	// barrier requests stand for the quiet requests written before them, see DispatchQuiet
+	barrier bool
 }
 
 type Response struct {
@@ -19,34 +26,259 @@ type Response struct {
 }
 
 // InnerMetaClient implements the memcached meta protocol
+// Reads and mutations go through separate pools of PoolSize connections, picked by key
 type InnerMetaClient struct {
-	target         ConnectionTarget
-	readClient     *BaseTCPClient
-	mutationClient *BaseTCPClient
+	target          ConnectionTarget
+	readClients     []*BaseTCPClient
+	mutationClients []*BaseTCPClient
+	opaque          atomic.Uint32
 }
 
 func NewInnerMetaClient(target ConnectionTarget) (*InnerMetaClient, error) {
-	r, err := NewBaseTCPClient(target)
+	target, err := target.withDefaults()
 	if err != nil {
 		return nil, err
 	}
-	m, err := NewBaseTCPClient(target)
+	c := &InnerMetaClient{target: target}
+	for i := 0; i < 2*target.PoolSize; i++ {
+		tc, err := NewBaseTCPClient(target)
+		if err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+		if i < target.PoolSize {
+			c.readClients = append(c.readClients, tc)
+		} else {
+			c.mutationClients = append(c.mutationClients, tc)
+		}
+	}
+	if err := c.negotiate(); err != nil {
+		c.Shutdown()
+		return nil, fmt.Errorf("server %s: %w", c.Address(), err)
+	}
+	return c, nil
+}
+
+// negotiate checks that the server is recent enough to support the meta protocol, and answers it
+func (c *InnerMetaClient) negotiate() error {
+	r, err := c.await(c.readClients[0].Dispatch([]byte("version\r\n")))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if r.Header[0] != "VERSION" || len(r.Header) < 2 {
+		return fmt.Errorf("%w: invalid version response %s", ErrUnsupportedServer, strings.Join(r.Header, " "))
+	}
+	if !supportsMeta(r.Header[1]) {
+		return fmt.Errorf("%w: version %s, at least %d.%d.%d is required", ErrUnsupportedServer, r.Header[1], minVersion[0], minVersion[1], minVersion[2])
+	}
+	r, err = c.await(c.readClients[0].Dispatch([]byte("mn\r\n")))
+	if len(r.Header) == 0 {
+		return err
+	}
+	if r.Header[0] != "MN" {
+		return fmt.Errorf("%w: meta no-op answered with %s", ErrUnsupportedServer, strings.Join(r.Header, " "))
+	}
+	return nil
+}
+
+// the meta protocol was introduced in memcached 1.6, but its responses only settled in 1.6.10,
+// which answers HD where earlier versions answer OK
+var minVersion = [3]int{1, 6, 10}
+
+// supportsMeta checks that a server version, such as 1.6.21, is recent enough for the meta protocol
+func supportsMeta(version string) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	var v [3]int
+	for i, p := range parts {
+		if i == 2 {
+			// patch versions can carry a suffix, such as 1.6.21-beta
+			p = p[:len(p)-len(strings.TrimLeft(p, "0123456789"))]
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return false
+		}
+		v[i] = n
+	}
+	for i := range v {
+		if v[i] != minVersion[i] {
+			return v[i] > minVersion[i]
+		}
+	}
+	return true
+}
+
+// negotiation waits at least this long, as request timeouts tuned for serving can be too short
+// for the first requests of a connection
+const minNegotiationTimeoutMs = 1000
+
+// await waits for a negotiation response, up to the timeout of the target
+func (c *InnerMetaClient) await(ch <-chan Response) (Response, error) {
+	select {
+	case r := <-ch:
+		return r, checkResponse(r)
+	case <-time.After(time.Duration(max(c.target.TimeoutMs, minNegotiationTimeoutMs)) * time.Millisecond):
+		return Response{}, ErrRequestTimeout
 	}
-	return &InnerMetaClient{readClient: r, mutationClient: m, target: target}, nil
 }
 
 func (c *InnerMetaClient) Shutdown() {
-	c.mutationClient.Shutdown()
-	c.readClient.Shutdown()
+	for _, tc := range c.mutationClients {
+		tc.Shutdown()
+	}
+	for _, tc := range c.readClients {
+		tc.Shutdown()
+	}
+}
+
+// readClient returns the connection of the read pool for a command
+func (c *InnerMetaClient) readClient(command []byte) *BaseTCPClient {
+	return pooled(c.readClients, command)
+}
+
+// mutationClient returns the connection of the mutation pool for a command
+func (c *InnerMetaClient) mutationClient(command []byte) *BaseTCPClient {
+	return pooled(c.mutationClients, command)
+}
+
+// pooled picks the connection of a command by the key it's about, so that the commands about
+// a key are sent in order, over the same connection
+func pooled(pool []*BaseTCPClient, command []byte) *BaseTCPClient {
+	if len(pool) == 1 {
+		return pool[0]
+	}
+	line, _, _ := strings.Cut(string(command), "\r\n")
+	tokens := strings.Fields(line)
+	if len(tokens) < 2 {
+		return pool[0]
+	}
+	return pool[stringToUint64(tokens[1])%uint64(len(pool))]
+}
+
+// Address returns the host:port of the server
+func (c *InnerMetaClient) Address() string {
+	return net.JoinHostPort(c.target.Address, strconv.Itoa(c.target.Port))
+}
+
+// Stats returns the statistics of a section, "" for the general statistics of the server
+func (c *InnerMetaClient) Stats(section string) (map[string]string, error) {
+	command := "stats\r\n"
+	if section != "" {
+		if strings.ContainsAny(section, " \r\n") {
+			return nil, fmt.Errorf("invalid stats section: %q", section)
+		}
+		command = fmt.Sprintf("stats %s\r\n", section)
+	}
+	r, err := c.read([]byte(command))
+	if err != nil {
+		return nil, err
+	}
+	switch r.Header[0] {
+	case "STAT", "END":
+		return parseStats(r.Value), nil
+	default:
+		return nil, fmt.Errorf("invalid response: %s", r.Header[0])
+	}
+}
+
+func parseStats(value []byte) map[string]string {
+	stats := make(map[string]string)
+	for _, line := range strings.Split(string(value), "\r\n") {
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) < 2 || parts[0] != "STAT" {
+			continue
+		}
+		if len(parts) == 3 {
+			stats[parts[1]] = parts[2]
+		} else {
+			stats[parts[1]] = ""
+		}
+	}
+	return stats
+}
+
+// FlushAll invalidates every entry of the server, after delay seconds if not 0
+func (c *InnerMetaClient) FlushAll(delay int) error {
+	if delay > 0 {
+		return c.admin(fmt.Sprintf("flush_all %d\r\n", delay))
+	}
+	return c.admin("flush_all\r\n")
+}
+
+// Version returns the version of the server
+func (c *InnerMetaClient) Version() (string, error) {
+	r, err := c.read([]byte("version\r\n"))
+	if err != nil {
+		return "", err
+	}
+	if r.Header[0] != "VERSION" || len(r.Header) < 2 {
+		return "", fmt.Errorf("invalid response: %s", strings.Join(r.Header, " "))
+	}
+	return r.Header[1], nil
+}
+
+// Verbosity sets the logging level of the server
+func (c *InnerMetaClient) Verbosity(level int) error {
+	return c.admin(fmt.Sprintf("verbosity %d\r\n", level))
+}
+
+// CacheMemlimit sets the memory limit of the server, in megabytes
+func (c *InnerMetaClient) CacheMemlimit(megabytes int) error {
+	return c.admin(fmt.Sprintf("cache_memlimit %d\r\n", megabytes))
+}
+
+// ShutdownServer asks the server to shut down, which it only does when started with -A
+// The server closes the connection when it complies
+func (c *InnerMetaClient) ShutdownServer(graceful bool) error {
+	command := "shutdown\r\n"
+	if graceful {
+		command = "shutdown graceful\r\n"
+	}
+	err := c.admin(command)
+	if errors.Is(err, ErrConnectionReset) {
+		return nil
+	}
+	return err
+}
+
+// admin sends a command answered with OK on the mutation connection
+func (c *InnerMetaClient) admin(command string) error {
+	ch := c.mutationClient([]byte(command)).Dispatch([]byte(command))
+	select {
+	case r := <-ch:
+		if err := checkResponse(r); err != nil {
+			return err
+		}
+		if r.Header[0] != "OK" {
+			return fmt.Errorf("invalid response: %s", strings.Join(r.Header, " "))
+		}
+		return nil
+	case <-time.After(time.Duration(c.target.TimeoutMs) * time.Millisecond):
+		return ErrRequestTimeout
+	}
+}
+
+// Healthy reports whether every connection to the server is healthy
+func (c *InnerMetaClient) Healthy() bool {
+	for _, tc := range append(c.readClients, c.mutationClients...) {
+		if !tc.Healthy() {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *InnerMetaClient) Info(key string) (EntryInfo, error) {
-	ch := c.readClient.Dispatch([]byte(fmt.Sprintf("me %s\r\n", key)))
-	r := <-ch
-	if r.Error != nil {
-		return EntryInfo{}, fmt.Errorf("operation failed: %w", r.Error)
+	command, err := c.command("me", key, "")
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	r, err := c.read(command)
+	if err != nil {
+		return EntryInfo{}, err
 	}
 	switch r.Header[0] {
 	case "ME":
@@ -109,16 +341,137 @@ func getDebugValue(input string) string {
 }
 
 func (c *InnerMetaClient) Delete(key string) (MutationResult, error) {
-	command := fmt.Sprintf("md %s\r\n", key)
-	return c.mutation([]byte(command))
+	return c.DeleteAsync(key).Wait()
+}
+
+func (c *InnerMetaClient) DeleteAsync(key string) *Future[MutationResult] {
+	command, err := c.command("md", key, "")
+	if err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return c.mutationAsync(command)
+}
+
+// DeleteNoReply deletes an entry in quiet mode, not waiting for the server to answer
+func (c *InnerMetaClient) DeleteNoReply(key string) error {
+	command, err := c.command("md", key, " q")
+	if err != nil {
+		return err
+	}
+	return c.mutationClient(command).DispatchQuiet(command)
+}
+
+// Invalidate marks an entry as stale instead of deleting it, updating its TTL
+func (c *InnerMetaClient) Invalidate(key string, ttl int) (MutationResult, error) {
+	command, err := c.command("md", key, fmt.Sprintf(" I T%d", ttl))
+	if err != nil {
+		return Error, err
+	}
+	return c.mutation(command)
 }
 
 func (c *InnerMetaClient) Get(key string) ([]byte, error) {
-	ch := c.readClient.Dispatch([]byte(fmt.Sprintf("mg %s t f v\r\n", key)))
-	r := <-ch
-	if r.Error != nil {
-		return nil, fmt.Errorf("operation failed: %w", r.Error)
+	item, err := c.GetItem(key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (c *InnerMetaClient) GetAsync(key string) *Future[[]byte] {
+	command, err := c.command("mg", key, " v")
+	if err != nil {
+		return failedFuture[[]byte](err)
+	}
+	ch := c.readClient(command).Dispatch(command)
+	return newFuture(func() ([]byte, error) {
+		r := <-ch
+		if err := checkResponse(r); err != nil {
+			return nil, err
+		}
+		return valueResponse(r)
+	})
+}
+
+func (c *InnerMetaClient) GetItem(key string) (*Item, error) {
+	command, err := c.command("mg", key, " t f v")
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.read(command)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Header[0] {
+	case "VA":
+		gr, err := flagsToGetResult(r.Value, metaFlags(r.Header[2:]))
+		if err != nil {
+			return nil, err
+		}
+		return &Item{Value: gr.Value, Flags: gr.Flags, TimeToLive: storableTtl(gr.TimeToLive)}, nil
+	case "EN":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid response: %s", r.Header[0])
+	}
+}
+
+// storableTtl turns a remaining TTL returned by the server into one that can be stored back
+// memcached reads TTLs over 30 days as unix timestamps, and -1 means the entry doesn't expire
+func storableTtl(remaining int) int {
+	switch {
+	case remaining < 0:
+		return 0
+	case remaining > maxRelativeTtl:
+		return int(time.Now().Unix()) + remaining
+	default:
+		return remaining
+	}
+}
+
+const maxRelativeTtl = 60 * 60 * 24 * 30
+
+// GetAndTouch gets an entry and updates its time to live in a single request
+func (c *InnerMetaClient) GetAndTouch(key string, ttl int) ([]byte, error) {
+	command, err := c.command("mg", key, fmt.Sprintf(" v T%d", ttl))
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.read(command)
+	if err != nil {
+		return nil, err
+	}
+	return valueResponse(r)
+}
+
+// GetAndDelete gets an entry and deletes it, both requests are written together on the
+// mutation connection so no other mutation can happen in between
+func (c *InnerMetaClient) GetAndDelete(key string) ([]byte, error) {
+	get, err := c.command("mg", key, " v")
+	if err != nil {
+		return nil, err
 	}
+	del, err := c.command("md", key, "")
+	if err != nil {
+		return nil, err
+	}
+	chs := c.mutationClient(get).DispatchMany(get, del)
+	g, d := <-chs[0], <-chs[1]
+	if err := checkResponse(g); err != nil {
+		return nil, err
+	}
+	if err := checkResponse(d); err != nil {
+		return nil, err
+	}
+	switch d.Header[0] {
+	case "HD", "NF":
+	default:
+		return nil, fmt.Errorf("invalid response: %s", d.Header[0])
+	}
+	return valueResponse(g)
+}
+
+func valueResponse(r Response) ([]byte, error) {
 	switch r.Header[0] {
 	case "VA":
 		return r.Value, nil
@@ -129,56 +482,365 @@ func (c *InnerMetaClient) Get(key string) ([]byte, error) {
 	}
 }
 
+func (c *InnerMetaClient) GetEx(key string, opts GetOptions) (GetResult, error) {
+	command, err := c.command("mg", key, getFlags(opts))
+	if err != nil {
+		return GetResult{}, err
+	}
+	r, err := c.read(command)
+	if err != nil {
+		return GetResult{}, err
+	}
+	switch r.Header[0] {
+	case "VA":
+		return flagsToGetResult(r.Value, metaFlags(r.Header[2:]))
+	case "HD":
+		return flagsToGetResult(nil, metaFlags(r.Header[1:]))
+	case "EN":
+		return GetResult{}, nil
+	default:
+		return GetResult{}, fmt.Errorf("invalid response: %s", r.Header[0])
+	}
+}
+
+func getFlags(opts GetOptions) string {
+	var sb strings.Builder
+	for _, f := range []struct {
+		requested bool
+		flag      string
+	}{
+		{opts.Value, " v"},
+		{opts.Flags, " f"},
+		{opts.TimeToLive, " t"},
+		{opts.CasId, " c"},
+		{opts.LastAccess, " l"},
+		{opts.Size, " s"},
+		{opts.HitBefore, " h"},
+		{opts.Key, " k"},
+	} {
+		if f.requested {
+			sb.WriteString(f.flag)
+		}
+	}
+	return sb.String()
+}
+
+func flagsToGetResult(value []byte, flags map[byte]string) (GetResult, error) {
+	result := GetResult{Found: true, Value: value}
+	if f, ok := flags['f']; ok {
+		v, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return GetResult{}, fmt.Errorf("fatal connection error parsing header: %w", err)
+		}
+		result.Flags = uint32(v)
+	}
+	for flag, field := range map[byte]*int{
+		't': &result.TimeToLive,
+		'c': &result.CasId,
+		'l': &result.LastAccess,
+		's': &result.Size,
+	} {
+		f, ok := flags[flag]
+		if !ok {
+			continue
+		}
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return GetResult{}, fmt.Errorf("fatal connection error parsing header: %w", err)
+		}
+		*field = v
+	}
+	result.HitBefore = flags['h'] == "1"
+	if k, ok := flags['k']; ok {
+		key, err := decodeKey(k, flags)
+		if err != nil {
+			return GetResult{}, fmt.Errorf("fatal connection error parsing header: %w", err)
+		}
+		result.Key = key
+	}
+	return result, nil
+}
+
+// GetRecache gets an entry, and hands out the right to recompute it to a single caller
+// when the entry is stale, or when its remaining TTL is below recacheTtl
+func (c *InnerMetaClient) GetRecache(key string, recacheTtl int) (RecacheResult, error) {
+	command, err := c.command("mg", key, fmt.Sprintf(" v R%d", recacheTtl))
+	if err != nil {
+		return RecacheResult{}, err
+	}
+	r, err := c.read(command)
+	if err != nil {
+		return RecacheResult{}, err
+	}
+	switch r.Header[0] {
+	case "VA":
+		flags := metaFlags(r.Header[2:])
+		_, won := flags['W']
+		_, stale := flags['X']
+		_, pending := flags['Z']
+		return RecacheResult{Value: r.Value, Won: won, Stale: stale, WinPending: pending}, nil
+	case "EN":
+		return RecacheResult{}, nil
+	default:
+		return RecacheResult{}, fmt.Errorf("invalid response: %s", r.Header[0])
+	}
+}
+
+// metaFlags indexes the flags returned in a meta response by their flag character
+func metaFlags(tokens []string) map[byte]string {
+	flags := make(map[byte]string, len(tokens))
+	for _, t := range tokens {
+		if len(t) > 0 {
+			flags[t[0]] = t[1:]
+		}
+	}
+	return flags
+}
+
 func (c *InnerMetaClient) GetMany(keys []string) (map[string][]byte, error) {
 	return nil, errors.New("bulk requests need to be requested via router")
 }
 
 func (c *InnerMetaClient) Set(key string, value []byte, ttl int) (MutationResult, error) {
-	command := fmt.Sprintf("ms %s %d T%d\r\n", key, len(value), ttl)
-	dpt := append(append([]byte(command), value...), []byte("\r\n")...)
-	return c.mutation(dpt)
+	return c.SetItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InnerMetaClient) SetAsync(key string, value []byte, ttl int) *Future[MutationResult] {
+	command, err := c.storeCommand(key, Item{Value: value, TimeToLive: ttl}, "")
+	if err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return c.mutationAsync(command)
+}
+
+func (c *InnerMetaClient) SetItem(key string, item Item) (MutationResult, error) {
+	return c.store(key, item, "")
+}
+
+// SetNoReply stores an entry in quiet mode, not waiting for the server to answer
+func (c *InnerMetaClient) SetNoReply(key string, value []byte, ttl int) error {
+	command, err := c.command("ms", key, fmt.Sprintf(" %d T%d q", len(value), ttl))
+	if err != nil {
+		return err
+	}
+	return c.mutationClient(command).DispatchQuiet(append(append(command, value...), []byte("\r\n")...))
 }
 
 func (c *InnerMetaClient) Touch(key string, ttl int) (MutationResult, error) {
-	command := fmt.Sprintf("mg %s T%d\r\n", key, ttl)
-	return c.mutation([]byte(command))
+	return c.TouchAsync(key, ttl).Wait()
+}
+
+func (c *InnerMetaClient) TouchAsync(key string, ttl int) *Future[MutationResult] {
+	command, err := c.command("mg", key, fmt.Sprintf(" T%d", ttl))
+	if err != nil {
+		return failedFuture[MutationResult](err)
+	}
+	return c.mutationAsync(command)
 }
 
 func (c *InnerMetaClient) Add(key string, value []byte, ttl int) (MutationResult, error) {
-	command := fmt.Sprintf("ms %s %d ME T%d\r\n", key, len(value), ttl)
-	dpt := append(append([]byte(command), value...), []byte("\r\n")...)
-	return c.mutation(dpt)
+	return c.AddItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InnerMetaClient) AddItem(key string, item Item) (MutationResult, error) {
+	return c.store(key, item, " ME")
 }
 
 func (c *InnerMetaClient) Replace(key string, value []byte, ttl int) (MutationResult, error) {
-	command := fmt.Sprintf("ms %s %d MR T%d\r\n", key, len(value), ttl)
-	dpt := append(append([]byte(command), value...), []byte("\r\n")...)
+	return c.ReplaceItem(key, Item{Value: value, TimeToLive: ttl})
+}
+
+func (c *InnerMetaClient) ReplaceItem(key string, item Item) (MutationResult, error) {
+	return c.store(key, item, " MR")
+}
+
+func (c *InnerMetaClient) Append(key string, value []byte) (MutationResult, error) {
+	return c.store(key, Item{Value: value}, " MA")
+}
+
+func (c *InnerMetaClient) AppendOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.store(key, Item{Value: value}, fmt.Sprintf(" MA N%d", ttl))
+}
+
+func (c *InnerMetaClient) Prepend(key string, value []byte) (MutationResult, error) {
+	return c.store(key, Item{Value: value}, " MP")
+}
+
+func (c *InnerMetaClient) PrependOrCreate(key string, value []byte, ttl int) (MutationResult, error) {
+	return c.store(key, Item{Value: value}, fmt.Sprintf(" MP N%d", ttl))
+}
+
+func (c *InnerMetaClient) store(key string, item Item, mode string) (MutationResult, error) {
+	dpt, err := c.storeCommand(key, item, mode)
+	if err != nil {
+		return Error, err
+	}
 	return c.mutation(dpt)
 }
 
+func (c *InnerMetaClient) storeCommand(key string, item Item, mode string) ([]byte, error) {
+	command, err := c.command("ms", key, fmt.Sprintf(" %d%s F%d T%d", len(item.Value), mode, item.Flags, item.TimeToLive))
+	if err != nil {
+		return nil, err
+	}
+	return append(append(command, item.Value...), []byte("\r\n")...), nil
+}
+
+// Batch sends all the operations in a single write on the mutation connection, so they are
+// executed in order, and waits for all of their responses
+func (c *InnerMetaClient) Batch(ops []BatchOp) []BatchResult {
+	results := make([]BatchResult, len(ops))
+	commands := make([][]byte, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		command, err := c.batchCommand(op)
+		if err != nil {
+			results[i] = BatchResult{Result: Error, Error: err}
+			continue
+		}
+		commands = append(commands, command)
+		indexes = append(indexes, i)
+	}
+
+	// larger batches would overload the connection, so they are sent in chunks, one after the other
+	size := max(c.target.MaxOutstandingRequests, 1)
+	for start := 0; start < len(commands); start += size {
+		end := min(start+size, len(commands))
+		c.dispatchBatch(ops, commands[start:end], indexes[start:end], results)
+	}
+	return results
+}
+
+// dispatchBatch sends the commands in a single write, and stores their results at their indexes
+func (c *InnerMetaClient) dispatchBatch(ops []BatchOp, commands [][]byte, indexes []int, results []BatchResult) {
+	timer := time.NewTimer(time.Duration(c.target.TimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+	expired := false
+	for j, ch := range c.mutationClient(commands[0]).DispatchMany(commands...) {
+		var r Response
+		if !expired {
+			select {
+			case r = <-ch:
+			case <-timer.C:
+				expired = true
+			}
+		}
+		if expired {
+			select {
+			case r = <-ch:
+			default:
+				results[indexes[j]] = BatchResult{Result: Error, Error: ErrRequestTimeout}
+				continue
+			}
+		}
+		results[indexes[j]] = batchResult(ops[indexes[j]].Op, r)
+	}
+}
+
+func (c *InnerMetaClient) batchCommand(op BatchOp) ([]byte, error) {
+	item := Item{Value: op.Value, Flags: op.Flags, TimeToLive: op.TimeToLive}
+	switch op.Op {
+	case OpGet:
+		return c.command("mg", op.Key, " v")
+	case OpSet:
+		return c.storeCommand(op.Key, item, "")
+	case OpAdd:
+		return c.storeCommand(op.Key, item, " ME")
+	case OpReplace:
+		return c.storeCommand(op.Key, item, " MR")
+	case OpDelete:
+		return c.command("md", op.Key, "")
+	case OpTouch:
+		return c.command("mg", op.Key, fmt.Sprintf(" T%d", op.TimeToLive))
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotBatchable, op.Op)
+	}
+}
+
+func batchResult(op Operation, r Response) BatchResult {
+	if op != OpGet {
+		m, err := mutationResponse(r)
+		return BatchResult{Result: m, Error: err}
+	}
+	if err := checkResponse(r); err != nil {
+		return BatchResult{Result: Error, Error: err}
+	}
+	v, err := valueResponse(r)
+	switch {
+	case err != nil:
+		return BatchResult{Result: Error, Error: err}
+	case v == nil:
+		return BatchResult{Result: NotFound}
+	default:
+		return BatchResult{Value: v, Result: Success}
+	}
+}
+
+// command builds a meta command for key followed by flags, validating the key and base64
+// encoding it when the target allows binary keys
+// Every command but the debug one carries an opaque token, that the server echoes back in its
+// response, so responses can be checked against the requests they are delivered to
+func (c *InnerMetaClient) command(cmd string, key string, flags string) ([]byte, error) {
+	k, binary, err := encodeKey(key, c.target.BinaryKeys)
+	if err != nil {
+		return nil, err
+	}
+	if binary {
+		flags += " b"
+	}
+	if cmd != "me" {
+		flags += " O" + strconv.FormatUint(uint64(c.opaque.Add(1)), 10)
+	}
+	return []byte(cmd + " " + k + flags + "\r\n"), nil
+}
+
+func (c *InnerMetaClient) read(command []byte) (Response, error) {
+	r := <-c.readClient(command).Dispatch(command)
+	return r, checkResponse(r)
+}
+
+func checkResponse(r Response) error {
+	if r.Error != nil {
+		return fmt.Errorf("operation failed: %w", r.Error)
+	}
+	if len(r.Header) == 0 {
+		return errors.New("empty response")
+	}
+	return nil
+}
+
 func (c *InnerMetaClient) mutation(command []byte) (MutationResult, error) {
-	ch := c.mutationClient.Dispatch(command)
-	select {
-	case r := <-ch:
-		if r.Error != nil {
-			return Error, fmt.Errorf("operation failed: %w", r.Error)
-		}
-		if len(r.Header) == 0 {
-			return Error, errors.New("empty response")
-		}
-		switch r.Header[0] {
-		case "HD":
-			return Success, nil
-		case "NS":
-			return NotStored, nil
-		case "EX":
-			return Exists, nil
-		case "NF", "EN":
-			return NotFound, nil
-		default:
-			return Error, fmt.Errorf("invalid response: %s", r.Header[0])
-		}
-	case <-time.After(time.Duration(c.mutationClient.TimeoutMs) * time.Millisecond):
-		return Error, ErrRequestTimeout
+	return c.mutationAsync(command).Wait()
+}
+
+// mutationAsync dispatches the command right away, its timeout counting from then
+func (c *InnerMetaClient) mutationAsync(command []byte) *Future[MutationResult] {
+	ch := c.mutationClient(command).Dispatch(command)
+	timeout := time.After(time.Duration(c.target.TimeoutMs) * time.Millisecond)
+	return newFuture(func() (MutationResult, error) {
+		select {
+		case r := <-ch:
+			return mutationResponse(r)
+		case <-timeout:
+			return Error, ErrRequestTimeout
+		}
+	})
+}
+
+func mutationResponse(r Response) (MutationResult, error) {
+	if err := checkResponse(r); err != nil {
+		return Error, err
+	}
+	switch r.Header[0] {
+	case "HD":
+		return Success, nil
+	case "NS":
+		return NotStored, nil
+	case "EX":
+		return Exists, nil
+	case "NF", "EN":
+		return NotFound, nil
+	default:
+		return Error, fmt.Errorf("invalid response: %s", r.Header[0])
 	}
 }
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStats(t *testing.T) {
+	stats := parseStats([]byte("STAT pid 1\r\nSTAT version 1.6.29\r\nSTAT items:1:number 5\r\nSTAT item_size_max 1048576\r\nSTAT evictions on\r\nSTAT ext_path \r\n"))
+	assert.Equal(t, map[string]string{
+		"pid":            "1",
+		"version":        "1.6.29",
+		"items:1:number": "5",
+		"item_size_max":  "1048576",
+		"evictions":      "on",
+		"ext_path":       "",
+	}, stats)
+	assert.Empty(t, parseStats(nil))
+}
+
+func TestSupportsMeta(t *testing.T) {
+	assert.True(t, supportsMeta("1.6.10"))
+	assert.True(t, supportsMeta("1.6.29"))
+	assert.True(t, supportsMeta("1.6.21-beta"))
+	assert.True(t, supportsMeta("1.7"))
+	assert.True(t, supportsMeta("2.0"))
+	assert.False(t, supportsMeta("1.6.9"), "Expected versions answering OK instead of HD to be refused")
+	assert.False(t, supportsMeta("1.6.0"))
+	assert.False(t, supportsMeta("1.6"))
+	assert.False(t, supportsMeta("1.5.22"))
+	assert.False(t, supportsMeta("1.4.39"))
+	assert.False(t, supportsMeta("unknown"))
+}
+
+func TestNegotiation(t *testing.T) {
+	s := fakeMemcached(t)
+	c, err := NewInnerMetaClient(fakeTarget(s))
+	assert.NoError(t, err, "Expected recent server to be accepted")
+	c.Shutdown()
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if command == "version" {
+			return memcachedtest.Action{Response: "VERSION 1.5.22\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	_, err = NewInnerMetaClient(fakeTarget(s))
+	assert.ErrorIs(t, err, ErrUnsupportedServer, "Expected old server to be refused")
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if command == "mn" {
+			return memcachedtest.Action{Response: "ERROR\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	_, err = NewInnerMetaClient(fakeTarget(s))
+	assert.ErrorIs(t, err, ErrUnsupportedServer, "Expected server without meta commands to be refused")
+
+	_, err = NewInnerMetaClient(ConnectionTarget{Address: "127.0.0.1", Port: 1, TimeoutMs: 1000})
+	assert.Error(t, err, "Expected dial error")
+}
+
+// connections returns the number of connections of the server of the client, as reported by the server
+func connections(c *InnerMetaClient) string {
+	stats, err := c.Stats("")
+	if err != nil {
+		return err.Error()
+	}
+	return stats["curr_connections"]
+}
+
+func TestShutdownClosesConnections(t *testing.T) {
+	s := fakeMemcached(t)
+	probe, err := NewInnerMetaClient(fakeTarget(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Shutdown()
+	assert.Equal(t, "2", connections(probe))
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if command == "version" {
+			return memcachedtest.Action{Response: "VERSION 1.5.0\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	for i := 0; i < 5; i++ {
+		_, err := NewInnerMetaClient(fakeTarget(s))
+		assert.ErrorIs(t, err, ErrUnsupportedServer)
+	}
+	s.SetHook(nil)
+	assert.Eventually(t, func() bool { return connections(probe) == "2" }, time.Second, 10*time.Millisecond, "Expected failed clients to close their connections")
+
+	c, err := SingleTargetClient(fakeTarget(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "4", connections(probe))
+	c.Shutdown()
+	assert.Eventually(t, func() bool { return connections(probe) == "2" }, time.Second, 10*time.Millisecond, "Expected shut down client to close its connections")
+
+	// a sharded client shuts down the clients it created before a server failed
+	_, err = ShardedClient(fakeTarget(s), ConnectionTarget{Address: "127.0.0.1", Port: 1})
+	assert.Error(t, err)
+	assert.Eventually(t, func() bool { return connections(probe) == "2" }, time.Second, 10*time.Millisecond, "Expected sharded client to close the connections it created")
+}
+
+func TestBatchLargerThanMaxOutstandingRequests(t *testing.T) {
+	c, err := SingleTargetClient(fakeTarget(fakeMemcached(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	items := make(map[string]Item)
+	keys := make([]string, 0, 25)
+	for i := 0; i < 25; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		items[k] = Item{Value: []byte(k)}
+		keys = append(keys, k)
+	}
+	mr, err := c.SetMany(items)
+	assert.NoError(t, err, "Expected a batch over MaxOutstandingRequests to be sent in chunks")
+	assert.Len(t, mr, 25)
+
+	p := c.Pipeline()
+	for _, k := range keys {
+		p.Get(k)
+	}
+	for i, r := range p.Exec() {
+		assert.NoError(t, r.Error)
+		assert.Equal(t, []byte(keys[i]), r.Value)
+	}
+}
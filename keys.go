@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidKey = errors.New("invalid key")
+
+const maxKeyLength = 250
+
+// encodeKey returns the key as it is sent to the server, and whether it was base64 encoded
+// Keys with whitespace, control or non ASCII characters can only be sent encoded, if binary is allowed
+func encodeKey(key string, binary bool) (string, bool, error) {
+	if len(key) == 0 {
+		return "", false, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if isTextKey(key) {
+		if len(key) > maxKeyLength {
+			return "", false, fmt.Errorf("%w: key is longer than %d bytes", ErrInvalidKey, maxKeyLength)
+		}
+		return key, false, nil
+	}
+	if !binary {
+		return "", false, fmt.Errorf("%w: key contains whitespace or control characters", ErrInvalidKey)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(key))
+	if len(encoded) > maxKeyLength {
+		return "", false, fmt.Errorf("%w: encoded key is longer than %d bytes", ErrInvalidKey, maxKeyLength)
+	}
+	return encoded, true, nil
+}
+
+// isTextKey reports whether memcached accepts the key as is, which excludes whitespace and control
+// characters, but not the bytes of UTF-8 characters
+func isTextKey(key string) bool {
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeKey decodes a key returned by the server with the k flag
+func decodeKey(key string, flags map[byte]string) (string, error) {
+	if _, ok := flags['b']; !ok {
+		return key, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeKey(t *testing.T) {
+	k, binary, err := encodeKey("plain-key", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain-key", k, "Expected text key to be sent as is")
+	assert.False(t, binary, "Expected text key not to be encoded")
+
+	k, binary, err = encodeKey("café", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "café", k, "Expected UTF-8 key to be sent as is")
+	assert.False(t, binary, "Expected UTF-8 key not to be encoded")
+
+	for _, key := range []string{"", "with space", "with\r\nnewline", "tab\t", "del\x7f", strings.Repeat("k", 251)} {
+		_, _, err = encodeKey(key, false)
+		assert.ErrorIs(t, err, ErrInvalidKey, "Expected key %q to be rejected", key)
+	}
+
+	k, binary, err = encodeKey("with space", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "d2l0aCBzcGFjZQ==", k, "Expected binary key to be base64 encoded")
+	assert.True(t, binary, "Expected binary key to be encoded")
+
+	_, _, err = encodeKey(strings.Repeat("\x00", 200), true)
+	assert.ErrorIs(t, err, ErrInvalidKey, "Expected encoded key over the limit to be rejected")
+
+	d, err := decodeKey(k, map[byte]string{'b': ""})
+	assert.NoError(t, err)
+	assert.Equal(t, "with space", d, "Expected key to be decoded")
+}
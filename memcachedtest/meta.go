@@ -0,0 +1,470 @@
+package memcachedtest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxKeyLength = 250
+
+// memcached reads TTLs over 30 days as unix timestamps
+const maxRelativeTtl = 60 * 60 * 24 * 30
+
+type metaFlag struct {
+	flag  byte
+	token string
+}
+
+// meta executes a meta command, with the mutex held
+func (s *Server) meta(tokens []string, data []byte) string {
+	cmd, sentKey := tokens[0], tokens[1]
+	rest := tokens[2:]
+	if cmd == "ms" {
+		rest = tokens[3:]
+	}
+	flags := make([]metaFlag, 0, len(rest))
+	set := make(map[byte]string, len(rest))
+	for _, t := range rest {
+		flags = append(flags, metaFlag{flag: t[0], token: t[1:]})
+		set[t[0]] = t[1:]
+	}
+	if len(sentKey) > maxKeyLength {
+		return "CLIENT_ERROR bad command line format\r\n"
+	}
+	key := sentKey
+	if _, ok := set['b']; ok {
+		decoded, err := base64.StdEncoding.DecodeString(sentKey)
+		if err != nil {
+			return "CLIENT_ERROR error decoding key\r\n"
+		}
+		key = string(decoded)
+	}
+	now := s.now()
+	e := s.lookup(key, now)
+	m := &metaRequest{server: s, key: key, sentKey: sentKey, flags: flags, set: set, now: now}
+	switch cmd {
+	case "mg":
+		return m.get(e)
+	case "ms":
+		return m.store(e, data)
+	case "md":
+		return m.delete(e)
+	case "ma":
+		return m.arithmetic(e)
+	default:
+		return m.debug(e)
+	}
+}
+
+type metaRequest struct {
+	server  *Server
+	key     string
+	sentKey string
+	flags   []metaFlag
+	set     map[byte]string
+	now     time.Time
+}
+
+func (m *metaRequest) has(flag byte) bool {
+	_, ok := m.set[flag]
+	return ok
+}
+
+func (m *metaRequest) intFlag(flag byte, fallback int) (int, bool) {
+	v, ok := m.set[flag]
+	if !ok {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// lookup returns the entry of a key, removing it if it expired
+func (s *Server) lookup(key string, now time.Time) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.exp.IsZero() && !now.Before(e.exp) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (s *Server) nextCas() uint64 {
+	s.cas++
+	return s.cas
+}
+
+func expiration(ttl int, now time.Time) time.Time {
+	switch {
+	case ttl == 0:
+		return time.Time{}
+	case ttl < 0:
+		return now
+	case ttl > maxRelativeTtl:
+		return time.Unix(int64(ttl), 0)
+	default:
+		return now.Add(time.Duration(ttl) * time.Second)
+	}
+}
+
+// remaining returns the remaining time to live of an entry, -1 if it never expires
+func remaining(e *entry, now time.Time) int {
+	if e.exp.IsZero() {
+		return -1
+	}
+	return int((e.exp.Sub(now) + time.Second - 1) / time.Second)
+}
+
+// size approximates the memory used by an entry the way memcached reports it
+func size(key string, e *entry) int {
+	return 56 + len(key) + 1 + len(e.value) + 2
+}
+
+// miss answers a command that found no entry, echoing the opaque token and key
+func (m *metaRequest) miss(code string) string {
+	return code + m.returnFlags(nil) + "\r\n"
+}
+
+// returnFlags renders the flags requested by the command, in order
+func (m *metaRequest) returnFlags(e *entry) string {
+	var sb strings.Builder
+	for _, f := range m.flags {
+		switch f.flag {
+		case 'O':
+			sb.WriteString(" O" + f.token)
+		case 'k':
+			sb.WriteString(" k" + m.sentKey)
+		case 'b':
+			sb.WriteString(" b")
+		}
+		if e == nil {
+			continue
+		}
+		switch f.flag {
+		case 'c':
+			fmt.Fprintf(&sb, " c%d", e.cas)
+		case 'f':
+			fmt.Fprintf(&sb, " f%d", e.flags)
+		case 'h':
+			if e.fetched {
+				sb.WriteString(" h1")
+			} else {
+				sb.WriteString(" h0")
+			}
+		case 'l':
+			fmt.Fprintf(&sb, " l%d", int(m.now.Sub(e.access)/time.Second))
+		case 's':
+			fmt.Fprintf(&sb, " s%d", len(e.value))
+		case 't':
+			fmt.Fprintf(&sb, " t%d", remaining(e, m.now))
+		}
+	}
+	return sb.String()
+}
+
+func (m *metaRequest) get(e *entry) string {
+	if e == nil {
+		ttl, ok := m.intFlag('N', 0)
+		if !ok {
+			return "CLIENT_ERROR bad token in command line format\r\n"
+		}
+		if !m.has('N') {
+			if m.has('q') {
+				return ""
+			}
+			return m.miss("EN")
+		}
+		// autovivify, handing out the right to fill the entry
+		e = &entry{exp: expiration(ttl, m.now), cas: m.server.nextCas(), access: m.now, won: true}
+		m.server.entries[m.key] = e
+		return m.value(e, " W")
+	}
+	if ttl, ok := m.intFlag('T', 0); !ok {
+		return "CLIENT_ERROR bad token in command line format\r\n"
+	} else if m.has('T') {
+		e.exp = expiration(ttl, m.now)
+	}
+	var recache string
+	if m.has('R') || e.stale {
+		threshold, ok := m.intFlag('R', 0)
+		if !ok {
+			return "CLIENT_ERROR bad token in command line format\r\n"
+		}
+		r := remaining(e, m.now)
+		if e.stale || (m.has('R') && r != -1 && r < threshold) {
+			if e.won {
+				recache = " Z"
+			} else {
+				e.won = true
+				recache = " W"
+			}
+		}
+		if e.stale {
+			recache += " X"
+		}
+	}
+	response := m.value(e, recache)
+	e.fetched = true
+	e.access = m.now
+	return response
+}
+
+// value answers a hit, with the value if requested
+func (m *metaRequest) value(e *entry, extra string) string {
+	flags := m.returnFlags(e) + extra
+	if m.has('v') {
+		return fmt.Sprintf("VA %d%s\r\n%s\r\n", len(e.value), flags, e.value)
+	}
+	return "HD" + flags + "\r\n"
+}
+
+func (m *metaRequest) store(e *entry, data []byte) string {
+	ttl, ok := m.intFlag('T', 0)
+	if !ok {
+		return "CLIENT_ERROR bad token in command line format\r\n"
+	}
+	clientFlags, ok := m.intFlag('F', 0)
+	if !ok {
+		return "CLIENT_ERROR bad token in command line format\r\n"
+	}
+	if cas, ok := m.set['C']; ok && e != nil && cas != strconv.FormatUint(e.cas, 10) {
+		return m.miss("EX")
+	}
+	mode := m.set['M']
+	switch mode {
+	case "", "S", "s":
+	case "E", "e":
+		if e != nil {
+			return m.miss("NS")
+		}
+	case "R", "r":
+		if e == nil {
+			return m.miss("NS")
+		}
+	case "A", "a", "P", "p":
+		if e == nil {
+			vivify, ok := m.intFlag('N', 0)
+			if !ok {
+				return "CLIENT_ERROR bad token in command line format\r\n"
+			}
+			if !m.has('N') {
+				return m.miss("NS")
+			}
+			ttl = vivify
+			break
+		}
+		if mode == "A" || mode == "a" {
+			data = append(append([]byte{}, e.value...), data...)
+		} else {
+			data = append(append([]byte{}, data...), e.value...)
+		}
+		// appends keep the flags and time to live of the entry
+		e.value = data
+		e.cas = m.server.nextCas()
+		return m.stored(e)
+	default:
+		return "CLIENT_ERROR invalid mode for ms\r\n"
+	}
+	e = &entry{value: append([]byte{}, data...), flags: uint32(clientFlags), exp: expiration(ttl, m.now), cas: m.server.nextCas(), access: m.now}
+	m.server.entries[m.key] = e
+	return m.stored(e)
+}
+
+func (m *metaRequest) stored(e *entry) string {
+	if m.has('q') {
+		return ""
+	}
+	return "HD" + m.returnFlags(e) + "\r\n"
+}
+
+func (m *metaRequest) delete(e *entry) string {
+	if e == nil {
+		if m.has('q') {
+			return ""
+		}
+		return m.miss("NF")
+	}
+	if m.has('I') {
+		// invalidation marks the entry stale instead of removing it
+		ttl, ok := m.intFlag('T', 0)
+		if !ok {
+			return "CLIENT_ERROR bad token in command line format\r\n"
+		}
+		e.stale = true
+		e.won = false
+		if m.has('T') {
+			e.exp = expiration(ttl, m.now)
+		}
+	} else {
+		delete(m.server.entries, m.key)
+	}
+	if m.has('q') {
+		return ""
+	}
+	return "HD" + m.returnFlags(nil) + "\r\n"
+}
+
+func (m *metaRequest) arithmetic(e *entry) string {
+	delta, ok := m.intFlag('D', 1)
+	if !ok || delta < 0 {
+		return "CLIENT_ERROR bad token in command line format\r\n"
+	}
+	if e == nil {
+		ttl, ok := m.intFlag('N', 0)
+		if !ok {
+			return "CLIENT_ERROR bad token in command line format\r\n"
+		}
+		if !m.has('N') {
+			if m.has('q') {
+				return ""
+			}
+			return m.miss("NF")
+		}
+		initial, ok := m.intFlag('J', 0)
+		if !ok || initial < 0 {
+			return "CLIENT_ERROR bad token in command line format\r\n"
+		}
+		e = &entry{value: []byte(strconv.Itoa(initial)), exp: expiration(ttl, m.now), cas: m.server.nextCas(), access: m.now}
+		m.server.entries[m.key] = e
+	} else {
+		n, err := strconv.ParseUint(string(e.value), 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+		}
+		switch m.set['M'] {
+		case "", "I", "i", "+":
+			n += uint64(delta)
+		case "D", "d", "-":
+			// decrements stop at 0
+			n -= min(n, uint64(delta))
+		default:
+			return "CLIENT_ERROR invalid mode for ma\r\n"
+		}
+		e.value = []byte(strconv.FormatUint(n, 10))
+		e.cas = m.server.nextCas()
+		if ttl, ok := m.intFlag('T', 0); ok && m.has('T') {
+			e.exp = expiration(ttl, m.now)
+		}
+	}
+	if m.has('q') && !m.has('v') {
+		return ""
+	}
+	return m.value(e, "")
+}
+
+func (m *metaRequest) debug(e *entry) string {
+	if e == nil {
+		return "EN\r\n"
+	}
+	fetch := "no"
+	if e.fetched {
+		fetch = "yes"
+	}
+	return fmt.Sprintf("ME %s exp=%d la=%d cas=%d fetch=%s cls=1 size=%d\r\n",
+		m.sentKey, remaining(e, m.now), int(m.now.Sub(e.access)/time.Second), e.cas, fetch, size(m.key, e))
+}
+
+// stats answers the statistics of a section, every entry being counted in slab class 1
+func (s *Server) stats(args []string) string {
+	if len(args) > 1 {
+		return "ERROR\r\n"
+	}
+	now := s.now()
+	items := 0
+	for k := range s.entries {
+		if s.lookup(k, now) != nil {
+			items++
+		}
+	}
+	var sb strings.Builder
+	section := ""
+	if len(args) == 1 {
+		section = args[0]
+	}
+	switch section {
+	case "":
+		fmt.Fprintf(&sb, "STAT pid 1\r\nSTAT time %d\r\nSTAT version %s\r\nSTAT curr_items %d\r\nSTAT curr_connections %d\r\n",
+			now.Unix(), Version, items, len(s.conns))
+	case "settings":
+		sb.WriteString("STAT maxbytes 67108864\r\nSTAT maxconns 1024\r\nSTAT item_size_max 1048576\r\n")
+	case "items":
+		if items > 0 {
+			fmt.Fprintf(&sb, "STAT items:1:number %d\r\n", items)
+		}
+	case "slabs":
+		if items > 0 {
+			sb.WriteString("STAT 1:chunk_size 96\r\n")
+		}
+		fmt.Fprintf(&sb, "STAT active_slabs %d\r\n", min(items, 1))
+	case "conns":
+		i := 0
+		for conn := range s.conns {
+			fmt.Fprintf(&sb, "STAT %d:addr tcp:%s\r\n", i, conn.RemoteAddr())
+			i++
+		}
+	default:
+		return "ERROR\r\n"
+	}
+	sb.WriteString("END\r\n")
+	return sb.String()
+}
+
+func (s *Server) flushAll(args []string) string {
+	if len(args) > 1 {
+		return "ERROR\r\n"
+	}
+	delay := 0
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.Atoi(args[0]); err != nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+	}
+	if delay <= 0 {
+		s.entries = make(map[string]*entry)
+		return "OK\r\n"
+	}
+	exp := expiration(delay, s.now())
+	for _, e := range s.entries {
+		if e.exp.IsZero() || e.exp.After(exp) {
+			e.exp = exp
+		}
+	}
+	return "OK\r\n"
+}
+
+// metadump lists every entry, sorted by key, the way the LRU crawler does
+func (s *Server) metadump() string {
+	now := s.now()
+	keys := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		if s.lookup(k, now) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		e := s.entries[k]
+		exp := int64(-1)
+		if !e.exp.IsZero() {
+			exp = e.exp.Unix()
+		}
+		fetch := "no"
+		if e.fetched {
+			fetch = "yes"
+		}
+		fmt.Fprintf(&sb, "key=%s exp=%d la=%d cas=%d fetch=%s cls=1 size=%d\r\n",
+			url.QueryEscape(k), exp, e.access.Unix(), e.cas, fetch, size(k, e))
+	}
+	sb.WriteString("END\r\n")
+	return sb.String()
+}
@@ -0,0 +1,232 @@
+// Package memcachedtest provides an in-memory memcached server, to test code using the client
+// without a real memcached. It implements the meta commands (mg, ms, md, me, mn, ma) along with
+// version, stats, flush_all, verbosity, cache_memlimit and lru_crawler metadump, and hooks to
+// inject latency, disconnects and malformed responses.
+package memcachedtest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the memcached version the server reports
+const Version = "1.6.21"
+
+// Action is what the server does with a command, as decided by a Hook
+// The server waits for Delay, then closes the connection if Disconnect is set, or writes Response
+// instead of executing the command if it's not empty. The zero Action executes the command.
+type Action struct {
+	Delay      time.Duration
+	Disconnect bool
+	Response   string
+}
+
+// A Hook is called with every command line the server reads, without its trailing \r\n
+type Hook func(command string) Action
+
+// Server is an in-memory memcached server listening on a local port
+type Server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	entries  map[string]*entry
+	cas      uint64
+	hook     Hook
+	now      func() time.Time
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+type entry struct {
+	value   []byte
+	flags   uint32
+	exp     time.Time
+	cas     uint64
+	access  time.Time
+	fetched bool
+	stale   bool
+	won     bool
+}
+
+// NewServer starts a server listening on a random local port
+func NewServer() (*Server, error) {
+	return NewServerAt("127.0.0.1:0")
+}
+
+// NewServerAt starts a server listening on the address, e.g. to bring back a server that was closed
+func NewServerAt(address string) (*Server, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		entries:  make(map[string]*entry),
+		now:      time.Now,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Address returns the host:port the server listens on
+func (s *Server) Address() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the host the server listens on
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// SetHook sets the hook called with every command, nil to remove it
+func (s *Server) SetHook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hook = h
+}
+
+// SetClock replaces the clock the server uses to expire entries, time.Now by default
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Close stops the server, closing every connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		// the data block of a store is read before the hook decides, so the connection stays in sync
+		var data []byte
+		if tokens[0] == "ms" && len(tokens) >= 3 {
+			size, err := strconv.Atoi(tokens[2])
+			if err != nil || size < 0 {
+				w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+				w.Flush()
+				return
+			}
+			data = make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			data = data[:size]
+		}
+
+		s.mu.Lock()
+		hook := s.hook
+		s.mu.Unlock()
+		var action Action
+		if hook != nil {
+			action = hook(line)
+		}
+		if action.Delay > 0 {
+			time.Sleep(action.Delay)
+		}
+		if action.Disconnect {
+			return
+		}
+		if action.Response != "" {
+			w.WriteString(action.Response)
+		} else {
+			w.WriteString(s.execute(tokens, data))
+		}
+		// responses are flushed once every pipelined command was read, as memcached does
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) execute(tokens []string, data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch tokens[0] {
+	case "mn":
+		return "MN\r\n"
+	case "version":
+		return "VERSION " + Version + "\r\n"
+	case "mg", "ms", "md", "me", "ma":
+		// stores also need the size of their data block
+		if len(tokens) < 2 || (tokens[0] == "ms" && len(tokens) < 3) {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		return s.meta(tokens, data)
+	case "stats":
+		return s.stats(tokens[1:])
+	case "flush_all":
+		return s.flushAll(tokens[1:])
+	case "verbosity", "cache_memlimit":
+		if len(tokens) != 2 {
+			return "ERROR\r\n"
+		}
+		if _, err := strconv.Atoi(tokens[1]); err != nil {
+			return "CLIENT_ERROR bad command line format\r\n"
+		}
+		return "OK\r\n"
+	case "shutdown":
+		return "ERROR: shutdown not enabled\r\n"
+	case "lru_crawler":
+		if len(tokens) == 3 && tokens[1] == "metadump" && (tokens[2] == "all" || tokens[2] == "hash") {
+			return s.metadump()
+		}
+		return "ERROR\r\n"
+	default:
+		return "ERROR\r\n"
+	}
+}
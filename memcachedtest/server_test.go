@@ -0,0 +1,165 @@
+package memcachedtest_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	client "github.com/jsp-lqk/metapipe-memcached"
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(t *testing.T) *memcachedtest.Server {
+	s, err := memcachedtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func newClient(t *testing.T, s *memcachedtest.Server) client.Client {
+	c, err := client.SingleTargetClient(client.ConnectionTarget{Address: s.Host(), Port: s.Port(), MaxOutstandingRequests: 100, TimeoutMs: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Shutdown)
+	return c
+}
+
+// roundTrip sends raw commands, and reads lines of response
+func roundTrip(t *testing.T, s *memcachedtest.Server, commands string, lines int) []string {
+	conn, err := net.Dial("tcp", s.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(commands)); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	responses := make([]string, 0, lines)
+	for i := 0; i < lines; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, strings.TrimRight(line, "\r\n"))
+	}
+	return responses
+}
+
+func TestServer(t *testing.T) {
+	s := newServer(t)
+	c := newClient(t, s)
+
+	r, err := c.SetItem("key", client.Item{Value: []byte("value"), Flags: 3, TimeToLive: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, client.Success, r)
+	item, err := c.GetItem("key")
+	assert.NoError(t, err)
+	assert.Equal(t, &client.Item{Value: []byte("value"), Flags: 3, TimeToLive: 100}, item)
+
+	r, err = c.Delete("key")
+	assert.NoError(t, err)
+	assert.Equal(t, client.Success, r)
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "Expected deleted entry to be gone")
+}
+
+func TestServerExpiresEntries(t *testing.T) {
+	s := newServer(t)
+	now := time.Now()
+	s.SetClock(func() time.Time { return now })
+	c := newClient(t, s)
+
+	if _, err := c.Set("key", []byte("value"), 10); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(9 * time.Second)
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v, "Expected entry to be alive")
+
+	now = now.Add(time.Second)
+	v, err = c.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "Expected entry to expire")
+}
+
+func TestServerArithmetic(t *testing.T) {
+	s := newServer(t)
+	assert.Equal(t, []string{
+		"NF O1",
+		"VA 1 O2", "5",
+		"VA 1 O3", "7",
+		"VA 1", "0",
+	}, roundTrip(t, s, "ma counter O1\r\nma counter N0 J5 v O2\r\nma counter D2 v O3\r\nma counter MD D10 v\r\n", 7))
+
+	assert.Equal(t, []string{"HD", "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		roundTrip(t, s, "ms text 1\r\na\r\nma text\r\n", 2))
+}
+
+func TestServerMalformedCommands(t *testing.T) {
+	s := newServer(t)
+	assert.Equal(t, []string{
+		"CLIENT_ERROR bad command line format",
+		"CLIENT_ERROR bad command line format",
+		"MN",
+	}, roundTrip(t, s, "ms key\r\nmg\r\nmn\r\n", 3), "Expected the server to answer malformed commands and carry on")
+}
+
+func TestServerMetadump(t *testing.T) {
+	s := newServer(t)
+	assert.Equal(t, []string{"HD", "HD"}, roundTrip(t, s, "ms a:b 1\r\na\r\nms c 1 T0\r\nc\r\n", 2))
+
+	dump := roundTrip(t, s, "lru_crawler metadump all\r\n", 3)
+	assert.True(t, strings.HasPrefix(dump[0], "key=a%3Ab exp=-1 "), "Expected url encoded key")
+	assert.True(t, strings.HasPrefix(dump[1], "key=c exp=-1 "))
+	assert.Equal(t, "END", dump[2])
+}
+
+func TestServerHooks(t *testing.T) {
+	s := newServer(t)
+	c := newClient(t, s)
+	if _, err := c.Set("key", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "ms ") {
+			return memcachedtest.Action{Delay: 200 * time.Millisecond}
+		}
+		return memcachedtest.Action{}
+	})
+	_, err := c.Set("key", []byte("value"), 0)
+	assert.ErrorIs(t, err, client.ErrRequestTimeout, "Expected slow response to time out")
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "mg ") {
+			return memcachedtest.Action{Response: "GARBAGE\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	_, err = c.Get("key")
+	assert.Error(t, err, "Expected malformed response to fail")
+
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "mg ") {
+			return memcachedtest.Action{Disconnect: true}
+		}
+		return memcachedtest.Action{}
+	})
+	_, err = c.Get("key")
+	assert.ErrorIs(t, err, client.ErrConnectionReset, "Expected disconnect to fail the request")
+
+	s.SetHook(nil)
+	assert.Eventually(t, func() bool {
+		v, err := c.Get("key")
+		return err == nil && string(v) == "value"
+	}, time.Second, 10*time.Millisecond, "Expected client to reconnect")
+}
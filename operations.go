@@ -0,0 +1,95 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrOperationNotAllowed = errors.New("operation not allowed")
+
+// Operation identifies a Client operation, operations can be combined into sets with |
+type Operation uint
+
+const (
+	OpAdd Operation = 1 << iota
+	OpDelete
+	OpGet
+	OpInfo
+	OpReplace
+	OpSet
+	OpTouch
+	OpInvalidate
+	OpAppend
+	OpPrepend
+	// OpStats covers reading server statistics and versions
+	OpStats
+	// OpFlush covers flushing every entry of the servers
+	OpFlush
+	// OpAdmin covers every other administrative command, such as shutting servers down
+	OpAdmin
+	// OpDump covers enumerating the keys of the servers
+	OpDump
+)
+
+// ReadOperations are the operations that never modify the cache
+const ReadOperations = OpGet | OpInfo | OpStats | OpDump
+
+// WriteOperations are the operations that modify the cache
+const WriteOperations = OpAdd | OpDelete | OpReplace | OpSet | OpTouch | OpInvalidate | OpAppend | OpPrepend | OpFlush
+
+// AllOperations is the set of every operation
+const AllOperations = ReadOperations | WriteOperations | OpAdmin
+
+var operationNames = map[Operation]string{
+	OpAdd:        "add",
+	OpDelete:     "delete",
+	OpGet:        "get",
+	OpInfo:       "info",
+	OpReplace:    "replace",
+	OpSet:        "set",
+	OpTouch:      "touch",
+	OpInvalidate: "invalidate",
+	OpAppend:     "append",
+	OpPrepend:    "prepend",
+	OpStats:      "stats",
+	OpFlush:      "flush",
+	OpAdmin:      "admin",
+	OpDump:       "dump",
+}
+
+func (o Operation) String() string {
+	names := make([]string, 0, len(operationNames))
+	for op := Operation(1); op != 0 && op <= o; op <<= 1 {
+		if o&op == 0 {
+			continue
+		}
+		if name, ok := operationNames[op]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("Operation(%d)", uint(op)))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// AllowOnly returns a copy of the client that only allows the given operations, any other fails
+// with ErrOperationNotAllowed. For example, c.AllowOnly(ReadOperations) is a read-only client.
+// The copy shares the connections of the original client, so shutting down either shuts down both.
+func (c *Client) AllowOnly(ops Operation) Client {
+	return Client{router: c.router, denied: c.denied | (AllOperations &^ ops)}
+}
+
+// Deny returns a copy of the client that additionally forbids the given operations, which fail
+// with ErrOperationNotAllowed. For example, c.Deny(OpDelete) is a client that can't delete.
+// The copy shares the connections of the original client, so shutting down either shuts down both.
+func (c *Client) Deny(ops Operation) Client {
+	return Client{router: c.router, denied: c.denied | ops}
+}
+
+func (c *Client) allowed(op Operation) error {
+	if c.denied&op != 0 {
+		return fmt.Errorf("%w: %s", ErrOperationNotAllowed, op)
+	}
+	return nil
+}
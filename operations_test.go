@@ -0,0 +1,37 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationRestrictions(t *testing.T) {
+	inner := &flakyClient{}
+	c := Client{router: &DirectRouter{client: inner}}
+
+	ro := c.AllowOnly(ReadOperations)
+	_, err := ro.Set("key", []byte("value"), 0)
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected read-only client to refuse sets")
+	_, err = ro.Get("key")
+	assert.NoError(t, err, "Expected read-only client to allow gets")
+	assert.Equal(t, 1, inner.calls, "Expected get to reach the server")
+
+	wo := c.AllowOnly(WriteOperations)
+	_, err = wo.Get("key")
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected write-only client to refuse gets")
+
+	nd := c.Deny(OpDelete | OpTouch)
+	_, err = nd.Delete("key")
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected client to refuse deletes")
+	assert.EqualError(t, err, "operation not allowed: delete")
+	_, err = nd.Touch("key", 0)
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected client to refuse touches")
+
+	// restrictions only add up
+	all := nd.AllowOnly(AllOperations)
+	_, err = all.Delete("key")
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected restrictions to be kept")
+
+	assert.Equal(t, "delete|touch", (OpDelete | OpTouch).String())
+}
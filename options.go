@@ -0,0 +1,203 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidOption = errors.New("invalid option")
+
+// An Option configures a Client when it's created
+// Connection options, such as WithTimeout, only apply to the clients created with New, as the
+// clients given to NewClient are already connected, so NewClient rejects them
+type Option func(o *options) error
+
+type options struct {
+	denied Operation
+	target ConnectionTarget
+	// connection lists the connection options applied, which NewClient rejects
+	connection []string
+}
+
+// connectionOption marks opt as a connection option
+func connectionOption(name string, opt Option) Option {
+	return func(o *options) error {
+		o.connection = append(o.connection, name)
+		return opt(o)
+	}
+}
+
+func applyOptions(opts []Option) (options, error) {
+	var o options
+	for _, opt := range opts {
+		if opt == nil {
+			return options{}, fmt.Errorf("%w: nil option", ErrInvalidOption)
+		}
+		if err := opt(&o); err != nil {
+			return options{}, err
+		}
+	}
+	return o, nil
+}
+
+// WithAllowedOperations only allows the given operations, like Client.AllowOnly
+func WithAllowedOperations(ops Operation) Option {
+	return func(o *options) error {
+		o.denied |= AllOperations &^ ops
+		return nil
+	}
+}
+
+// WithDeniedOperations forbids the given operations, like Client.Deny
+func WithDeniedOperations(ops Operation) Option {
+	return func(o *options) error {
+		o.denied |= ops
+		return nil
+	}
+}
+
+func notNegative(name string, value int) error {
+	if value < 0 {
+		return fmt.Errorf("%w: negative %s %d", ErrInvalidOption, name, value)
+	}
+	return nil
+}
+
+// milliseconds converts a duration, rounding up so that no positive duration becomes 0
+func milliseconds(name string, d time.Duration) (int, error) {
+	if d < 0 {
+		return 0, fmt.Errorf("%w: negative %s %s", ErrInvalidOption, name, d)
+	}
+	return int((d + time.Millisecond - 1) / time.Millisecond), nil
+}
+
+// WithMaxOutstandingRequests limits the requests waiting for a response on each connection
+func WithMaxOutstandingRequests(n int) Option {
+	return connectionOption("WithMaxOutstandingRequests", func(o *options) error {
+		o.target.MaxOutstandingRequests = n
+		return notNegative("max outstanding requests", n)
+	})
+}
+
+// WithTimeout sets how long requests wait for their response
+func WithTimeout(d time.Duration) Option {
+	return connectionOption("WithTimeout", func(o *options) (err error) {
+		o.target.TimeoutMs, err = milliseconds("timeout", d)
+		return err
+	})
+}
+
+// WithDialTimeout sets how long connecting to a server can take
+func WithDialTimeout(d time.Duration) Option {
+	return connectionOption("WithDialTimeout", func(o *options) (err error) {
+		o.target.DialTimeoutMs, err = milliseconds("dial timeout", d)
+		return err
+	})
+}
+
+// WithReadTimeout sets how long a connection can wait for the next response while responses are
+// due, after which it's considered half-open, and reconnected, failing its outstanding requests
+// It also bounds the wait for each line of a DumpKeys stream
+func WithReadTimeout(d time.Duration) Option {
+	return connectionOption("WithReadTimeout", func(o *options) (err error) {
+		o.target.ReadTimeoutMs, err = milliseconds("read timeout", d)
+		return err
+	})
+}
+
+// WithWriteTimeout sets how long writing requests to a connection can take, after which it's reconnected
+func WithWriteTimeout(d time.Duration) Option {
+	return connectionOption("WithWriteTimeout", func(o *options) (err error) {
+		o.target.WriteTimeoutMs, err = milliseconds("write timeout", d)
+		return err
+	})
+}
+
+// WithKeepAlive sets the interval of the TCP keepalive probes
+func WithKeepAlive(d time.Duration) Option {
+	return connectionOption("WithKeepAlive", func(o *options) (err error) {
+		o.target.KeepAliveMs, err = milliseconds("keepalive", d)
+		return err
+	})
+}
+
+// WithTLS connects to the servers over TLS
+func WithTLS(config *tls.Config) Option {
+	return connectionOption("WithTLS", func(o *options) error {
+		if config == nil {
+			return fmt.Errorf("%w: nil TLS config", ErrInvalidOption)
+		}
+		o.target.TLS = config
+		return nil
+	})
+}
+
+// WithPoolSize sets the number of connections to each server, for reads and for mutations
+func WithPoolSize(n int) Option {
+	return connectionOption("WithPoolSize", func(o *options) error {
+		o.target.PoolSize = n
+		return notNegative("pool size", n)
+	})
+}
+
+// WithBufferSizes sets the sizes of the read and write buffers of each connection
+func WithBufferSizes(read, write int) Option {
+	return connectionOption("WithBufferSizes", func(o *options) error {
+		o.target.ReadBufferSize = read
+		o.target.WriteBufferSize = write
+		return errors.Join(notNegative("read buffer size", read), notNegative("write buffer size", write))
+	})
+}
+
+// WithLogger sets the logger of connection problems, which are printed to stdout by default
+func WithLogger(l Logger) Option {
+	return connectionOption("WithLogger", func(o *options) error {
+		if l == nil {
+			return fmt.Errorf("%w: nil logger", ErrInvalidOption)
+		}
+		o.target.Logger = l
+		return nil
+	})
+}
+
+// WithMetrics reports measurements of the connections to m
+func WithMetrics(m Metrics) Option {
+	return connectionOption("WithMetrics", func(o *options) error {
+		if m == nil {
+			return fmt.Errorf("%w: nil metrics", ErrInvalidOption)
+		}
+		o.target.Metrics = m
+		return nil
+	})
+}
+
+// WithHealthCheck probes the servers every interval, considering them unhealthy after as many
+// consecutive failures. An interval of 0 disables health checks.
+func WithHealthCheck(interval time.Duration, failures int) Option {
+	return connectionOption("WithHealthCheck", func(o *options) (err error) {
+		o.target.HealthCheckFailures = failures
+		o.target.HealthCheckIntervalMs, err = milliseconds("health check interval", interval)
+		return errors.Join(err, notNegative("health check failures", failures))
+	})
+}
+
+// WithCircuitBreaker wraps every server in a CircuitBreaker
+func WithCircuitBreaker(settings CircuitBreakerSettings) Option {
+	return connectionOption("WithCircuitBreaker", func(o *options) error {
+		if err := settings.validate(); err != nil {
+			return err
+		}
+		o.target.CircuitBreaker = &settings
+		return nil
+	})
+}
+
+// WithBinaryKeys allows keys with whitespace, control or non ASCII characters, sent base64 encoded
+func WithBinaryKeys() Option {
+	return connectionOption("WithBinaryKeys", func(o *options) error {
+		o.target.BinaryKeys = true
+		return nil
+	})
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsp-lqk/metapipe-memcached/memcachedtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixRouter sends the keys starting with "local:" to its first client, the others to its second
+type prefixRouter struct {
+	local, remote MemcacheClient
+}
+
+func (r *prefixRouter) Route(key string) MemcacheClient {
+	if len(key) > 6 && key[:6] == "local:" {
+		return r.local
+	}
+	return r.remote
+}
+
+func (r *prefixRouter) Clients() []MemcacheClient {
+	return []MemcacheClient{r.local, r.remote}
+}
+
+func (r *prefixRouter) Shutdown() {}
+
+func TestNewClient(t *testing.T) {
+	local, remote := NewInMemoryClient(nil), NewInMemoryClient(nil)
+	c, err := NewClient(&prefixRouter{local: local, remote: remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Set("local:key", []byte("value"), 0)
+	assert.NoError(t, err)
+	v, err := local.Get("local:key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v, "Expected key to be routed by the custom router")
+
+	ro, err := NewClient(&prefixRouter{local: local, remote: remote}, WithAllowedOperations(ReadOperations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ro.Set("key", []byte("value"), 0)
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected read-only client to refuse sets")
+	v, err = ro.Get("local:key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), v)
+
+	nd, err := NewClient(NewShardedRouter(local, remote), WithDeniedOperations(OpDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nd.Delete("local:key")
+	assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected client to refuse deletes")
+
+	_, err = NewClient(nil)
+	assert.Error(t, err, "Expected client without router to fail")
+	_, err = NewClient(NewShardedRouter())
+	assert.Error(t, err, "Expected client without servers to fail")
+	_, err = NewClient(NewDirectRouter(local), nil)
+	assert.ErrorIs(t, err, ErrInvalidOption)
+	for _, opt := range []Option{WithTimeout(time.Second), WithPoolSize(2), WithTLS(&tls.Config{}), WithBinaryKeys()} {
+		_, err = NewClient(NewDirectRouter(local), opt)
+		assert.ErrorIs(t, err, ErrInvalidOption, "Expected connection options to be rejected")
+	}
+}
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	responses map[string]int
+	connects  int
+}
+
+func (m *recordingMetrics) Response(server string, command string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[command]++
+}
+
+func (m *recordingMetrics) Connect(server string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connects++
+}
+
+func TestNew(t *testing.T) {
+	servers := []string{fakeMemcached(t).Address(), fakeMemcached(t).Address()}
+	metrics := &recordingMetrics{responses: make(map[string]int)}
+	c, err := New(servers,
+		WithPoolSize(2),
+		WithTimeout(500*time.Millisecond),
+		WithDialTimeout(time.Second),
+		WithKeepAlive(time.Minute),
+		WithBufferSizes(1024, 1024),
+		WithHealthCheck(0, 0),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithMetrics(metrics),
+		WithDeniedOperations(OpFlush),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	for i := 0; i < 20; i++ {
+		r, err := c.Set(fmt.Sprintf("key-%d", i), []byte("value"), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, Success, r)
+	}
+	for i := 0; i < 20; i++ {
+		v, err := c.Get(fmt.Sprintf("key-%d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("value"), v)
+	}
+	metrics.mu.Lock()
+	assert.Equal(t, 8, metrics.connects, "Expected two pools of two connections per server")
+	assert.Equal(t, 20, metrics.responses["ms"], "Expected a response metric per set")
+	assert.Equal(t, 20, metrics.responses["mg"], "Expected a response metric per get")
+	metrics.mu.Unlock()
+	for _, err := range c.Admin().FlushAll(0) {
+		assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected client options to apply")
+	}
+}
+
+func TestGetManyLogsErrors(t *testing.T) {
+	s := fakeMemcached(t)
+	s.SetHook(func(command string) memcachedtest.Action {
+		if strings.HasPrefix(command, "mg broken") {
+			return memcachedtest.Action{Response: "CLIENT_ERROR broken\r\n"}
+		}
+		return memcachedtest.Action{}
+	})
+	var out bytes.Buffer
+	c, err := New([]string{s.Address()}, WithLogger(log.New(&out, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	mp, err := c.GetMany([]string{"broken", "fine"})
+	assert.NoError(t, err)
+	assert.Nil(t, mp["broken"], "Expected failed get to be a miss")
+	assert.True(t, strings.HasPrefix(out.String(), "error getting key broken: "), "Expected the error in the logger of the client")
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "Expected a single line")
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	server := []string{fakeMemcached(t).Address()}
+	for _, opt := range []Option{
+		WithMaxOutstandingRequests(-1),
+		WithTimeout(-time.Second),
+		WithDialTimeout(-time.Second),
+		WithReadTimeout(-time.Second),
+		WithWriteTimeout(-time.Second),
+		WithPoolSize(-1),
+		WithBufferSizes(1024, -1),
+		WithHealthCheck(time.Second, -1),
+		WithCircuitBreaker(CircuitBreakerSettings{FailureRate: 2}),
+		WithTLS(nil),
+		WithLogger(nil),
+		WithMetrics(nil),
+	} {
+		_, err := New(server, opt)
+		assert.ErrorIs(t, err, ErrInvalidOption)
+	}
+	_, err := New(nil)
+	assert.Error(t, err, "Expected client without servers to fail")
+
+	// zero values take the defaults, instead of rejecting every request
+	target := fakeTarget(fakeMemcached(t))
+	target.MaxOutstandingRequests, target.TimeoutMs = 0, 0
+	c, err := SingleTargetClient(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	r, err := c.Set("key", []byte("value"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, Success, r)
+
+	target.PoolSize = -1
+	_, err = SingleTargetClient(target)
+	assert.ErrorIs(t, err, ErrInvalidOption)
+
+	target.PoolSize = 0
+	target.CircuitBreaker = &CircuitBreakerSettings{MinRequests: -1}
+	_, err = SingleTargetClient(target)
+	assert.ErrorIs(t, err, ErrInvalidOption)
+}
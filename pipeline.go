@@ -0,0 +1,217 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var ErrNotBatchable = errors.New("operation can't be batched")
+
+// BatchOp is a single operation of a batch, one of OpGet, OpSet, OpAdd, OpReplace, OpDelete or OpTouch
+// Value and Flags are only used by stores, and TimeToLive by stores and touches
+type BatchOp struct {
+	Op         Operation
+	Key        string
+	Value      []byte
+	Flags      uint32
+	TimeToLive int
+}
+
+// BatchResult is the outcome of a BatchOp
+// Gets result in Success along with the Value when the entry is found, and NotFound otherwise
+type BatchResult struct {
+	Value  []byte
+	Result MutationResult
+	Error  error
+}
+
+// A Batcher is a MemcacheClient that can send many operations to its server at once
+// Results are returned in the same order as the operations
+type Batcher interface {
+	Batch(ops []BatchOp) []BatchResult
+}
+
+// batch runs the operations with the client, one by one if it isn't a Batcher
+func batch(c MemcacheClient, ops []BatchOp) []BatchResult {
+	if b, ok := c.(Batcher); ok {
+		return b.Batch(ops)
+	}
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case OpGet:
+			v, err := c.Get(op.Key)
+			switch {
+			case err != nil:
+				results[i] = BatchResult{Result: Error, Error: err}
+			case v == nil:
+				results[i] = BatchResult{Result: NotFound}
+			default:
+				results[i] = BatchResult{Value: v, Result: Success}
+			}
+			continue
+		case OpSet:
+			results[i].Result, results[i].Error = setItem(c, op.Key, Item{Value: op.Value, Flags: op.Flags, TimeToLive: op.TimeToLive})
+		case OpAdd:
+			results[i].Result, results[i].Error = addItem(c, op.Key, Item{Value: op.Value, Flags: op.Flags, TimeToLive: op.TimeToLive})
+		case OpReplace:
+			results[i].Result, results[i].Error = replaceItem(c, op.Key, Item{Value: op.Value, Flags: op.Flags, TimeToLive: op.TimeToLive})
+		case OpDelete:
+			results[i].Result, results[i].Error = c.Delete(op.Key)
+		case OpTouch:
+			results[i].Result, results[i].Error = c.Touch(op.Key, op.TimeToLive)
+		default:
+			results[i] = BatchResult{Result: Error, Error: fmt.Errorf("%w: %s", ErrNotBatchable, op.Op)}
+		}
+	}
+	return results
+}
+
+// A Pipeline queues operations, to send them all at once when executed
+type Pipeline struct {
+	client *Client
+	ops    []BatchOp
+}
+
+// Creates a Pipeline, to queue many operations and send them together with Exec
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Queues getting the contents of an entry
+func (p *Pipeline) Get(key string) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpGet, Key: key})
+	return p
+}
+
+// Queues storing an entry
+func (p *Pipeline) Set(key string, value []byte, ttl int) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpSet, Key: key, Value: value, TimeToLive: ttl})
+	return p
+}
+
+// Queues storing an item
+func (p *Pipeline) SetItem(key string, item Item) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpSet, Key: key, Value: item.Value, Flags: item.Flags, TimeToLive: item.TimeToLive})
+	return p
+}
+
+// Queues storing an entry ONLY if the key does NOT exist in the server
+func (p *Pipeline) Add(key string, value []byte, ttl int) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpAdd, Key: key, Value: value, TimeToLive: ttl})
+	return p
+}
+
+// Queues storing an item ONLY if the key does NOT exist in the server
+func (p *Pipeline) AddItem(key string, item Item) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpAdd, Key: key, Value: item.Value, Flags: item.Flags, TimeToLive: item.TimeToLive})
+	return p
+}
+
+// Queues storing an entry ONLY if the key DOES exist in the server
+func (p *Pipeline) Replace(key string, value []byte, ttl int) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpReplace, Key: key, Value: value, TimeToLive: ttl})
+	return p
+}
+
+// Queues deleting an entry
+func (p *Pipeline) Delete(key string) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpDelete, Key: key})
+	return p
+}
+
+// Queues updating the time to live of an entry
+func (p *Pipeline) Touch(key string, ttl int) *Pipeline {
+	p.ops = append(p.ops, BatchOp{Op: OpTouch, Key: key, TimeToLive: ttl})
+	return p
+}
+
+// Sends the queued operations, in a single write per server, and returns their results in the
+// order they were queued. Operations on the same server are executed in order.
+// The pipeline is empty afterwards, and can be reused.
+func (p *Pipeline) Exec() []BatchResult {
+	ops := p.ops
+	p.ops = nil
+	return p.client.batch(ops)
+}
+
+// Stores many items, sending a single write per server
+// Returns the result of every key, along with the errors of the keys that failed
+func (c *Client) SetMany(items map[string]Item) (map[string]MutationResult, error) {
+	ops := make([]BatchOp, 0, len(items))
+	for k, item := range items {
+		ops = append(ops, BatchOp{Op: OpSet, Key: k, Value: item.Value, Flags: item.Flags, TimeToLive: item.TimeToLive})
+	}
+	return manyResults(ops, c.batch(ops))
+}
+
+// Deletes many entries, sending a single write per server
+// Returns the result of every key, along with the errors of the keys that failed
+func (c *Client) DeleteMany(keys []string) (map[string]MutationResult, error) {
+	ops := make([]BatchOp, 0, len(keys))
+	for _, k := range keys {
+		ops = append(ops, BatchOp{Op: OpDelete, Key: k})
+	}
+	return manyResults(ops, c.batch(ops))
+}
+
+func manyResults(ops []BatchOp, results []BatchResult) (map[string]MutationResult, error) {
+	mr := make(map[string]MutationResult, len(ops))
+	var errs []error
+	for i, op := range ops {
+		mr[op.Key] = results[i].Result
+		if results[i].Error != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", op.Key, results[i].Error))
+		}
+	}
+	return mr, errors.Join(errs...)
+}
+
+// batch groups the operations by server, and runs the groups concurrently
+func (c *Client) batch(ops []BatchOp) []BatchResult {
+	results := make([]BatchResult, len(ops))
+	type group struct {
+		client  MemcacheClient
+		indexes []int
+	}
+	var groups []*group
+	byClient := make(map[MemcacheClient]*group)
+	for i, op := range ops {
+		if err := c.allowed(op.Op); err != nil {
+			results[i] = BatchResult{Result: Error, Error: err}
+			continue
+		}
+		s := c.route(op.Key, op.Op)
+		// clients that can't be map keys, such as structs holding a slice, get a group per operation
+		if !reflect.ValueOf(s).Comparable() {
+			groups = append(groups, &group{client: s, indexes: []int{i}})
+			continue
+		}
+		g, ok := byClient[s]
+		if !ok {
+			g = &group{client: s}
+			byClient[s] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range groups {
+		wg.Add(1)
+		go func(s MemcacheClient, indexes []int) {
+			defer wg.Done()
+			group := make([]BatchOp, len(indexes))
+			for j, i := range indexes {
+				group[j] = ops[i]
+			}
+			for j, r := range batch(s, group) {
+				results[indexes[j]] = r
+			}
+		}(g.client, g.indexes)
+	}
+	wg.Wait()
+	return results
+}
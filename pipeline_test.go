@@ -0,0 +1,94 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchingClient struct {
+	MemcacheClient
+	mu      sync.Mutex
+	batches [][]BatchOp
+}
+
+func (b *batchingClient) Batch(ops []BatchOp) []BatchResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, ops)
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = BatchResult{Value: []byte(op.Key), Result: Success}
+	}
+	return results
+}
+
+func TestPipelineSendsOneBatchPerServer(t *testing.T) {
+	clients := make([]MemcacheClient, 0, 3)
+	for i := 0; i < 3; i++ {
+		clients = append(clients, &batchingClient{})
+	}
+	c := Client{router: &ShardedRouter{clients: clients}}
+
+	p := c.Pipeline()
+	for i := 0; i < 30; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		switch i % 3 {
+		case 0:
+			p.Get(k)
+		case 1:
+			p.Set(k, []byte("value"), 0)
+		default:
+			p.Delete(k)
+		}
+	}
+	results := p.Exec()
+
+	assert.Len(t, results, 30)
+	for i, r := range results {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%d", i)), r.Value, "Expected results in the order operations were queued")
+	}
+	total := 0
+	for _, s := range clients {
+		b := s.(*batchingClient)
+		assert.LessOrEqual(t, len(b.batches), 1, "Expected at most one batch per server")
+		for _, batch := range b.batches {
+			total += len(batch)
+		}
+	}
+	assert.Equal(t, 30, total, "Expected every operation to be sent")
+	assert.Empty(t, p.Exec(), "Expected pipeline to be empty after Exec")
+}
+
+func TestPipelineChecksOperations(t *testing.T) {
+	inner := &flakyClient{}
+	c := Client{router: &DirectRouter{client: inner}}
+	ro := c.AllowOnly(ReadOperations)
+
+	results := ro.Pipeline().Get("key").Set("key", []byte("value"), 0).Exec()
+	assert.NoError(t, results[0].Error)
+	assert.Equal(t, NotFound, results[0].Result, "Expected miss from a client without batching")
+	assert.ErrorIs(t, results[1].Error, ErrOperationNotAllowed, "Expected set to be refused")
+	assert.Equal(t, 1, inner.calls, "Expected only the get to reach the server")
+}
+
+// unhashableClient is a value type that can't be a map key
+type unhashableClient struct {
+	MemcacheClient
+	servers []string
+}
+
+func (u unhashableClient) Get(key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func TestPipelineUnhashableClients(t *testing.T) {
+	c := Client{router: &DirectRouter{client: unhashableClient{servers: []string{"a"}}}}
+
+	results := c.Pipeline().Get("a").Get("b").Exec()
+	assert.Len(t, results, 2)
+	assert.Equal(t, []byte("a"), results[0].Value)
+	assert.Equal(t, []byte("b"), results[1].Value)
+}
@@ -5,14 +5,57 @@ type Router interface {
 	Shutdown()
 }
 
+// A ClientLister is a Router that lists every client it routes to, one per server
+// Server level operations, such as Stats, Admin and DumpKeys, fail with ErrNotSupported on other routers
+type ClientLister interface {
+	Clients() []MemcacheClient
+}
+
+// A HealthReporter is a MemcacheClient that knows whether its server is currently reachable
+// Routers avoid sending keys to clients that report themselves as unhealthy
+type HealthReporter interface {
+	Healthy() bool
+}
+
+func isHealthy(c MemcacheClient) bool {
+	if h, ok := c.(HealthReporter); ok {
+		return h.Healthy()
+	}
+	return true
+}
+
+// An OwnerRouter is a Router that may route keys away from the client owning them, e.g. while it's unhealthy
+// Operations modifying the cache are sent to the owner, as an entry modified elsewhere is served unchanged
+// by the owner once it's back, while reads can be answered by any server, at worst as a miss
+type OwnerRouter interface {
+	Owner(key string) MemcacheClient
+}
+
+// route returns the client of the key for the operations, its owner when any of them modifies the cache
+func (c *Client) route(key string, ops Operation) MemcacheClient {
+	if o, ok := c.router.(OwnerRouter); ok && ops&WriteOperations != 0 {
+		return o.Owner(key)
+	}
+	return c.router.Route(key)
+}
+
+// DirectRouter routes every key to a single client
 type DirectRouter struct {
 	client MemcacheClient
 }
 
+func NewDirectRouter(client MemcacheClient) *DirectRouter {
+	return &DirectRouter{client: client}
+}
+
 func (r *DirectRouter) Route(key string) MemcacheClient {
 	return r.client
 }
 
+func (r *DirectRouter) Clients() []MemcacheClient {
+	return []MemcacheClient{r.client}
+}
+
 func (r *DirectRouter) Shutdown() {
 	r.client.Shutdown()
 }
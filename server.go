@@ -0,0 +1,185 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A ServerClient is a MemcacheClient connected to a single server, supporting server level commands
+type ServerClient interface {
+	MemcacheClient
+	Address() string
+	CacheMemlimit(megabytes int) error
+	DumpKeys(mode DumpMode) *KeyIterator
+	FlushAll(delay int) error
+	ShutdownServer(graceful bool) error
+	Stats(section string) (map[string]string, error)
+	Verbosity(level int) error
+	Version() (string, error)
+}
+
+// serverClient finds the ServerClient of a client, unwrapping it if needed
+func serverClient(c MemcacheClient) (ServerClient, bool) {
+	for {
+		if s, ok := c.(ServerClient); ok {
+			return s, true
+		}
+		u, ok := c.(interface{ Unwrap() MemcacheClient })
+		if !ok {
+			return nil, false
+		}
+		c = u.Unwrap()
+	}
+}
+
+// clients returns every client of the router, if it lists them
+func (c *Client) clients() ([]MemcacheClient, error) {
+	if l, ok := c.router.(ClientLister); ok {
+		return l.Clients(), nil
+	}
+	return nil, fmt.Errorf("%w: %T does not list its clients", ErrNotSupported, c.router)
+}
+
+// eachServer runs fn concurrently for every server of the client, returning its outcome by server address
+// Clients that don't support server commands fail, keyed by their position in the router and their type
+func (c *Client) eachServer(fn func(s ServerClient) error) map[string]error {
+	clients, err := c.clients()
+	if err != nil {
+		return map[string]error{fmt.Sprintf("%T", c.router): err}
+	}
+	outcomes := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, mc := range clients {
+		s, ok := serverClient(mc)
+		if !ok {
+			mu.Lock()
+			outcomes[fmt.Sprintf("client %d (%T)", i, mc)] = fmt.Errorf("%w: %T does not support server commands", ErrNotSupported, mc)
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(s ServerClient) {
+			defer wg.Done()
+			err := fn(s)
+			mu.Lock()
+			defer mu.Unlock()
+			outcomes[s.Address()] = err
+		}(s)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// joinOutcomes joins the errors of the servers that failed
+func joinOutcomes(outcomes map[string]error) error {
+	servers := make([]string, 0, len(outcomes))
+	for server, err := range outcomes {
+		if err != nil {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	errs := make([]error, 0, len(servers))
+	for _, server := range servers {
+		errs = append(errs, fmt.Errorf("server %s: %w", server, outcomes[server]))
+	}
+	return errors.Join(errs...)
+}
+
+// Gets the general statistics of every server, by server address
+func (c *Client) Stats() (map[string]map[string]string, error) {
+	return c.StatsFor("")
+}
+
+// Gets the statistics of a section of every server, by server address
+// Sections are for example "slabs", "items", "settings" or "conns", "" being the general statistics
+// Servers that fail are left out of the result, and their errors returned
+func (c *Client) StatsFor(section string) (map[string]map[string]string, error) {
+	if err := c.allowed(OpStats); err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]string)
+	var mu sync.Mutex
+	outcomes := c.eachServer(func(s ServerClient) error {
+		stats, err := s.Stats(section)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result[s.Address()] = stats
+		return nil
+	})
+	return result, joinOutcomes(outcomes)
+}
+
+// Returns the address of the server the key is routed to
+func (c *Client) Server(key string) (string, error) {
+	mc := c.router.Route(key)
+	s, ok := serverClient(mc)
+	if !ok {
+		return "", fmt.Errorf("%w: %T does not support server commands", ErrNotSupported, mc)
+	}
+	return s.Address(), nil
+}
+
+// Admin sends administrative commands to every server of a Client
+// Each command returns its outcome by server address, nil for the servers where it succeeded
+type Admin struct {
+	client *Client
+}
+
+// Returns the administrative commands of the client
+func (c *Client) Admin() Admin {
+	return Admin{client: c}
+}
+
+// run runs fn on every server, unless op is not allowed, in which case it fails for all of them
+func (a Admin) run(op Operation, fn func(s ServerClient) error) map[string]error {
+	if err := a.client.allowed(op); err != nil {
+		return a.client.eachServer(func(ServerClient) error { return err })
+	}
+	return a.client.eachServer(fn)
+}
+
+// Invalidates every entry of every server, after delay seconds if not 0
+func (a Admin) FlushAll(delay int) map[string]error {
+	return a.run(OpFlush, func(s ServerClient) error { return s.FlushAll(delay) })
+}
+
+// Gets the version of every server
+// Servers that fail are left out of the result, and their errors returned
+func (a Admin) Version() (map[string]string, error) {
+	result := make(map[string]string)
+	var mu sync.Mutex
+	outcomes := a.run(OpStats, func(s ServerClient) error {
+		v, err := s.Version()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result[s.Address()] = v
+		return nil
+	})
+	return result, joinOutcomes(outcomes)
+}
+
+// Sets the logging level of every server
+func (a Admin) Verbosity(level int) map[string]error {
+	return a.run(OpAdmin, func(s ServerClient) error { return s.Verbosity(level) })
+}
+
+// Sets the memory limit of every server, in megabytes
+func (a Admin) CacheMemlimit(megabytes int) map[string]error {
+	return a.run(OpAdmin, func(s ServerClient) error { return s.CacheMemlimit(megabytes) })
+}
+
+// Shuts down every server, which they only do when started with -A
+// Graceful shutdowns let servers finish what they are doing first
+func (a Admin) Shutdown(graceful bool) map[string]error {
+	return a.run(OpAdmin, func(s ServerClient) error { return s.ShutdownServer(graceful) })
+}
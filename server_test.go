@@ -0,0 +1,54 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// keyRouter routes every key to a single client, without listing its clients
+type keyRouter struct {
+	client MemcacheClient
+}
+
+func (r *keyRouter) Route(key string) MemcacheClient {
+	return r.client
+}
+
+func (r *keyRouter) Shutdown() {
+	r.client.Shutdown()
+}
+
+func TestRouterWithoutClientList(t *testing.T) {
+	c, err := NewClient(&keyRouter{client: NewInMemoryClient(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	_, err = c.Set("key", []byte("value"), 0)
+	assert.NoError(t, err, "Expected key operations to work")
+	_, err = c.Stats()
+	assert.ErrorIs(t, err, ErrNotSupported, "Expected statistics to need the clients of the router")
+	for _, err := range c.Admin().FlushAll(0) {
+		assert.ErrorIs(t, err, ErrNotSupported)
+	}
+	it := c.DumpKeys(DumpAll)
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), ErrNotSupported)
+}
+
+func TestEachServerWithMixedClients(t *testing.T) {
+	ic, err := NewInnerMetaClient(fakeTarget(fakeMemcached(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Client{router: NewShardedRouter(ic, NewInMemoryClient(nil), NewInMemoryClient(nil))}
+	defer c.Shutdown()
+
+	outcomes := c.Admin().Verbosity(1)
+	assert.Len(t, outcomes, 3, "Expected an outcome for every client")
+	assert.NoError(t, outcomes[ic.Address()])
+	assert.ErrorIs(t, outcomes["client 1 (*client.InMemoryClient)"], ErrNotSupported)
+	assert.ErrorIs(t, outcomes["client 2 (*client.InMemoryClient)"], ErrNotSupported)
+}
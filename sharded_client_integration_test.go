@@ -52,6 +52,10 @@ func TestShardedGetsAndSets(t *testing.T) {
 		defer c.Terminate(ctx)
 	}
 	shardedTest(t, servers)
+	shardedBulkMutations(t, servers)
+	shardedStats(t, servers)
+	shardedAdmin(t, servers)
+	shardedDumpKeys(t, servers)
 }
 
 func shardedTest(t *testing.T, targets []string) {
@@ -105,3 +109,158 @@ func shardedTest(t *testing.T, targets []string) {
 		assert.Equal(t, []byte(fmt.Sprintf("value-"+strings.TrimPrefix(k, "key-"))), mp[k], "Unexpected response value")
 	}
 }
+
+func shardedBulkMutations(t *testing.T, targets []string) {
+	c, err := DefaultClient(targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	items := make(map[string]Item, 50)
+	keys := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprintf("bulk-%d", i)
+		items[k] = Item{Value: []byte(fmt.Sprintf("bulk-value-%d", i)), Flags: uint32(i)}
+		keys = append(keys, k)
+	}
+
+	// set many
+	mr, err := c.SetMany(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, mr, 50)
+	for _, k := range keys {
+		assert.Equal(t, Success, mr[k], "Expected Success response")
+	}
+
+	mp, err := c.GetMany(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		assert.Equal(t, items[k].Value, mp[k], "Unexpected response value")
+	}
+
+	// delete many, including a missing key
+	deletes := append([]string{"bulk-missing"}, keys[:25]...)
+	mr, err = c.DeleteMany(deletes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys[:25] {
+		assert.Equal(t, Success, mr[k], "Expected Success response")
+	}
+	assert.Equal(t, NotFound, mr["bulk-missing"], "Expected NotFound response")
+
+	mp, err = c.GetMany(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range keys {
+		if i < 25 {
+			assert.Nil(t, mp[k], "Expected deleted entry")
+		} else {
+			assert.Equal(t, items[k].Value, mp[k], "Unexpected response value")
+		}
+	}
+}
+
+func shardedStats(t *testing.T, targets []string) {
+	c, err := DefaultClient(targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, stats, len(targets), "Expected statistics for every server")
+	for _, s := range stats {
+		assert.NotEmpty(t, s["version"], "Expected server version")
+	}
+
+	for _, section := range []string{"slabs", "items", "settings", "conns"} {
+		stats, err = c.StatsFor(section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, stats, len(targets), "Expected %s statistics for every server", section)
+	}
+	for _, s := range stats {
+		assert.NotEmpty(t, s, "Expected connection statistics")
+	}
+}
+
+func shardedAdmin(t *testing.T, targets []string) {
+	c, err := DefaultClient(targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	versions, err := c.Admin().Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, versions, len(targets), "Expected version of every server")
+
+	for i := 0; i < 20; i++ {
+		if _, err := c.Set(fmt.Sprintf("admin-%d", i), []byte("value"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for server, err := range c.Admin().FlushAll(0) {
+		assert.NoError(t, err, "Expected %s to be flushed", server)
+	}
+	for i := 0; i < 20; i++ {
+		gr, err := c.Get(fmt.Sprintf("admin-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, gr, "Expected flushed entry")
+	}
+
+	for server, err := range c.Admin().Verbosity(1) {
+		assert.NoError(t, err, "Expected %s verbosity to be set", server)
+	}
+
+	ro := c.AllowOnly(ReadOperations)
+	outcomes := ro.Admin().FlushAll(0)
+	assert.Len(t, outcomes, len(targets), "Expected outcome for every server")
+	for _, err := range outcomes {
+		assert.ErrorIs(t, err, ErrOperationNotAllowed, "Expected read-only client to refuse flushing")
+	}
+}
+
+func shardedDumpKeys(t *testing.T, targets []string) {
+	c, err := DefaultClient(targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	expected := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("dump-%d", i)
+		if _, err := c.Set(k, []byte("value"), 0); err != nil {
+			t.Fatal(err)
+		}
+		expected[k] = true
+	}
+
+	it := c.DumpKeys(DumpAll)
+	defer it.Close()
+	found := 0
+	for it.Next() {
+		if expected[it.Entry().Key] {
+			found++
+			assert.Equal(t, int64(-1), it.Entry().Expiration, "Expected entry without expiration")
+		}
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, len(expected), found, "Expected every key to be dumped")
+}
@@ -3,23 +3,51 @@ package client
 import (
 	"github.com/dgryski/go-jump"
 	"hash/fnv"
+	"strconv"
 )
 
+// ShardedRouter spreads the keys over its clients with jump consistent hashing
 type ShardedRouter struct {
 	clients []MemcacheClient
 }
 
+func NewShardedRouter(clients ...MemcacheClient) *ShardedRouter {
+	return &ShardedRouter{clients: clients}
+}
+
 func stringToUint64(s string) uint64 {
 	hasher := fnv.New64a()
 	hasher.Write([]byte(s))
 	return hasher.Sum64()
 }
 
+// Route returns the client owning the key. If that client is unhealthy, the key is rehashed
+// with a salt until it lands on a healthy client, so only the keys of the unhealthy server move.
+// When no healthy client is found, the owner is returned and fails fast.
+// Mutations are routed with Owner instead, see OwnerRouter.
 func (r *ShardedRouter) Route(key string) MemcacheClient {
 	i := jump.Hash(stringToUint64(key), len(r.clients))
+	if isHealthy(r.clients[i]) {
+		return r.clients[i]
+	}
+	for attempt := 1; attempt < len(r.clients); attempt++ {
+		j := jump.Hash(stringToUint64(strconv.Itoa(attempt)+":"+key), len(r.clients))
+		if isHealthy(r.clients[j]) {
+			return r.clients[j]
+		}
+	}
 	return r.clients[i]
 }
 
+// Owner returns the client owning the key, whether it's healthy or not
+func (r *ShardedRouter) Owner(key string) MemcacheClient {
+	return r.clients[jump.Hash(stringToUint64(key), len(r.clients))]
+}
+
+func (r *ShardedRouter) Clients() []MemcacheClient {
+	return r.clients
+}
+
 func (r *ShardedRouter) Shutdown() {
 	for _, c := range r.clients {
 		c.Shutdown()
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubClient struct {
+	MemcacheClient
+	healthy bool
+}
+
+func (s *stubClient) Healthy() bool {
+	return s.healthy
+}
+
+func TestShardedRouterReroutesUnhealthy(t *testing.T) {
+	clients := make([]MemcacheClient, 0, 5)
+	for i := 0; i < 5; i++ {
+		clients = append(clients, &stubClient{healthy: true})
+	}
+	r := &ShardedRouter{clients: clients}
+
+	owners := make(map[string]MemcacheClient, 1000)
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		owners[k] = r.Route(k)
+	}
+
+	sick := clients[2].(*stubClient)
+	sick.healthy = false
+	for k, owner := range owners {
+		routed := r.Route(k)
+		if owner == sick {
+			assert.NotEqual(t, sick, routed, "Expected key of unhealthy server to be rerouted")
+		} else {
+			assert.Equal(t, owner, routed, "Expected key of healthy server to stay in place")
+		}
+	}
+
+	for _, c := range clients {
+		c.(*stubClient).healthy = false
+	}
+	for k, owner := range owners {
+		assert.Equal(t, owner, r.Route(k), "Expected owner when no server is healthy")
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	clients := make([]MemcacheClient, 0, 3)
+	for i := 0; i < 3; i++ {
+		ic, err := NewInnerMetaClient(fakeTarget(fakeMemcached(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, ic)
+	}
+	c := Client{router: &ShardedRouter{clients: clients}}
+	defer c.Shutdown()
+
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		server, err := c.Server(k)
+		assert.NoError(t, err)
+		assert.Equal(t, c.router.Route(k).(*InnerMetaClient).Address(), server, "Expected address of the owner of the key")
+	}
+
+	stub := Client{router: &DirectRouter{client: &stubClient{}}}
+	_, err := stub.Server("key")
+	assert.Error(t, err, "Expected client without address to fail")
+}
+
+type switchableClient struct {
+	*InMemoryClient
+	healthy bool
+}
+
+func (s *switchableClient) Healthy() bool {
+	return s.healthy
+}
+
+func TestShardedRouterKeepsMutationsOnOwner(t *testing.T) {
+	clients := make([]MemcacheClient, 0, 3)
+	for i := 0; i < 3; i++ {
+		clients = append(clients, &switchableClient{InMemoryClient: NewInMemoryClient(nil), healthy: true})
+	}
+	c := Client{router: NewShardedRouter(clients...)}
+	defer c.Shutdown()
+
+	_, err := c.Set("key", []byte("old"), 0)
+	assert.NoError(t, err)
+	owner := c.router.(*ShardedRouter).Owner("key").(*switchableClient)
+	owner.healthy = false
+	assert.NotEqual(t, owner, c.router.Route("key"), "Expected reads to be rerouted")
+
+	// the delete reaches the owner, so it doesn't serve the old value once it recovers
+	_, err = c.Delete("key")
+	assert.NoError(t, err)
+	v, err := c.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "Expected miss on the fallback server")
+	owner.healthy = true
+	v, err = c.Get("key")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "Expected entry deleted during the outage to stay deleted")
+}
@@ -50,6 +50,15 @@ func TestMetaGetsAndSetsCommands(t *testing.T) {
 
 	simpleGetsAndSets(t, host, port)
 	allOtherOperations(t, host, port)
+	staleWhileRevalidate(t, host, port)
+	getWithMetadata(t, host, port)
+	itemsWithFlags(t, host, port)
+	appendAndPrepend(t, host, port)
+	getAndTouchAndDelete(t, host, port)
+	binaryKeys(t, host, port)
+	noReplyMutations(t, host, port)
+	pipelines(t, host, port)
+	asyncOperations(t, host, port)
 	triggerMaxConcurrent(t, host, port)
 	triggerTimeout(t, host, port)
 }
@@ -329,3 +338,429 @@ func allOtherOperations(t *testing.T, host string, port int) {
 	assert.Equal(t, 77, i.Size, "Expected size to be 77")
 	assert.GreaterOrEqual(t, 60, i.LastAccess, "Expected last access to have happened in the last minute")
 }
+
+func staleWhileRevalidate(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// miss - nobody wins
+	rr, err := c.GetRecache("stale-0", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, RecacheResult{}, rr, "Expected empty result on miss")
+
+	r, err := c.Set("stale-1", []byte("stale-1-value"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	// fresh entry without TTL - nobody wins
+	rr, err = c.GetRecache("stale-1", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, RecacheResult{Value: []byte("stale-1-value")}, rr, "Expected fresh value")
+
+	r, err = c.Invalidate("stale-1", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected entry to be invalidated")
+
+	// first get after invalidation wins the right to recompute
+	rr, err = c.GetRecache("stale-1", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("stale-1-value"), rr.Value, "Expected stale value")
+	assert.True(t, rr.Stale, "Expected entry to be stale")
+	assert.True(t, rr.Won, "Expected first caller to win")
+
+	// the following ones don't
+	rr, err = c.GetRecache("stale-1", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, rr.Stale, "Expected entry to be stale")
+	assert.False(t, rr.Won, "Expected second caller not to win")
+	assert.True(t, rr.WinPending, "Expected win to be pending")
+
+	// entry close to expiring - first caller wins
+	r, err = c.Set("stale-2", []byte("stale-2-value"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	rr, err = c.GetRecache("stale-2", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, rr.Stale, "Expected entry not to be stale")
+	assert.True(t, rr.Won, "Expected first caller to win")
+}
+
+func getWithMetadata(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	all := GetOptions{Value: true, Flags: true, TimeToLive: true, CasId: true, LastAccess: true, Size: true, HitBefore: true}
+
+	// miss
+	gr, err := c.GetEx("getex-0", all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, GetResult{}, gr, "Expected empty result on miss")
+
+	r, err := c.Set("getex-1", []byte("getex-1-value"), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	gr, err = c.GetEx("getex-1", all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, gr.Found, "Expected entry to be found")
+	assert.Equal(t, []byte("getex-1-value"), gr.Value, "Expected []byte of 'getex-1-value'")
+	assert.LessOrEqual(t, gr.TimeToLive, 1000, "Expected TTL to match set")
+	assert.Less(t, 0, gr.CasId, "Expected a CAS id")
+	assert.Less(t, 0, gr.Size, "Expected a size")
+	assert.False(t, gr.HitBefore, "Expected entry not to have been hit before")
+
+	// metadata only
+	gr, err = c.GetEx("getex-1", GetOptions{TimeToLive: true, HitBefore: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, gr.Found, "Expected entry to be found")
+	assert.Nil(t, gr.Value, "Expected no value")
+	assert.True(t, gr.HitBefore, "Expected entry to have been hit before")
+}
+
+func itemsWithFlags(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// miss
+	item, err := c.GetItem("item-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, item, "Expected nil item")
+
+	r, err := c.SetItem("item-1", Item{Value: []byte("item-1-value"), Flags: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	item, err = c.GetItem("item-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Item{Value: []byte("item-1-value"), Flags: 42}, item, "Expected item with flags and no TTL")
+
+	r, err = c.AddItem("item-1", Item{Value: []byte("item-1-value-1"), Flags: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NotStored, r, "Expected mutation to not be stored")
+
+	r, err = c.ReplaceItem("item-1", Item{Value: []byte("item-1-value-2"), Flags: 1 << 31, TimeToLive: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	item, err = c.GetItem("item-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("item-1-value-2"), item.Value, "Expected []byte of 'item-1-value-2'")
+	assert.Equal(t, uint32(1<<31), item.Flags, "Expected replaced flags")
+	assert.LessOrEqual(t, item.TimeToLive, 1000, "Expected TTL to match replace")
+}
+
+func appendAndPrepend(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// Append and Prepend - need the entry to exist
+	r, err := c.Append("append-1", []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NotStored, r, "Expected mutation to not be stored")
+
+	r, err = c.Prepend("append-1", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NotStored, r, "Expected mutation to not be stored")
+
+	// OrCreate variants - create the entry
+	r, err = c.AppendOrCreate("append-1", []byte("b"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	r, err = c.Append("append-1", []byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	r, err = c.Prepend("append-1", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	v, err := c.Get("append-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("abc"), v, "Expected []byte of 'abc'")
+
+	r, err = c.PrependOrCreate("prepend-1", []byte("z"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	v, err = c.Get("prepend-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("z"), v, "Expected []byte of 'z'")
+}
+
+func getAndTouchAndDelete(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// GetAndTouch - reads the value and updates the TTL
+	v, err := c.GetAndTouch("gat-0", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte(nil), v, "Expected nil value")
+
+	r, err := c.Set("gat-1", []byte("gat-1-value"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	v, err = c.GetAndTouch("gat-1", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("gat-1-value"), v, "Expected []byte of 'gat-1-value'")
+
+	i, err := c.Info("gat-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.LessOrEqual(t, i.TimeToLive, 1000, "Expected TTL to match touch")
+	assert.Less(t, 0, i.TimeToLive, "Expected TTL to match touch")
+
+	// GetAndDelete - reads the value and deletes the entry
+	v, err = c.GetAndDelete("gat-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("gat-1-value"), v, "Expected []byte of 'gat-1-value'")
+
+	v, err = c.GetAndDelete("gat-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte(nil), v, "Expected nil value")
+}
+
+func binaryKeys(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	// invalid keys are rejected before reaching the server
+	_, err = c.Set("with space", []byte("value"), 0)
+	assert.ErrorIs(t, err, ErrInvalidKey, "Expected key with spaces to be rejected")
+	_, err = c.Get(strings.Repeat("k", 251))
+	assert.ErrorIs(t, err, ErrInvalidKey, "Expected long key to be rejected")
+
+	// and the connection is still usable
+	r, err := c.Set("binary-0", []byte("binary-0-value"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	b, err := SingleTargetClient(ConnectionTarget{Address: host, Port: port, MaxOutstandingRequests: 1000, TimeoutMs: 1000, BinaryKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Shutdown()
+
+	key := "binary key\x00\xff"
+	r, err = b.Set(key, []byte("binary-1-value"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	gr, err := b.GetEx(key, GetOptions{Value: true, Key: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte("binary-1-value"), gr.Value, "Expected []byte of 'binary-1-value'")
+	assert.Equal(t, key, gr.Key, "Expected key to be decoded")
+}
+
+func noReplyMutations(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	for i := 0; i < 100; i++ {
+		if err := c.SetNoReply(fmt.Sprintf("quiet-%d", i), []byte(fmt.Sprintf("quiet-value-%d", i)), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// deletes of missing keys fail quietly
+	for i := 100; i < 110; i++ {
+		if err := c.DeleteNoReply(fmt.Sprintf("quiet-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.DeleteNoReply("quiet-0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// regular responses are still aligned with their requests
+	r, err := c.Set("quiet-x", []byte("quiet-x-value"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+
+	v, err := c.Get("quiet-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte(nil), v, "Expected nil value")
+
+	for i := 1; i < 100; i++ {
+		v, err = c.Get(fmt.Sprintf("quiet-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []byte(fmt.Sprintf("quiet-value-%d", i)), v, "Unexpected response value")
+	}
+}
+
+func pipelines(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	results := c.Pipeline().
+		Set("pipe-1", []byte("pipe-1-value"), 0).
+		Get("pipe-1").
+		Add("pipe-1", []byte("pipe-1-value-1"), 0).
+		Replace("pipe-2", []byte("pipe-2-value"), 0).
+		Touch("pipe-1", 1000).
+		Delete("pipe-1").
+		Get("pipe-1").
+		Exec()
+
+	assert.Len(t, results, 7)
+	for _, r := range results {
+		assert.NoError(t, r.Error)
+	}
+	assert.Equal(t, Success, results[0].Result, "Expected mutation to be stored successfully")
+	assert.Equal(t, BatchResult{Value: []byte("pipe-1-value"), Result: Success}, results[1], "Expected value set earlier in the pipeline")
+	assert.Equal(t, NotStored, results[2].Result, "Expected mutation to not be stored")
+	assert.Equal(t, NotStored, results[3].Result, "Expected mutation to not be stored")
+	assert.Equal(t, Success, results[4].Result, "Expected mutation to update TTL successfully")
+	assert.Equal(t, Success, results[5].Result, "Expected mutation to delete entry successfully")
+	assert.Equal(t, BatchResult{Result: NotFound}, results[6], "Expected entry to be deleted")
+}
+
+func asyncOperations(t *testing.T, host string, port int) {
+	c, err := DefaultClient(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	sets := make([]*Future[MutationResult], 0, 50)
+	for i := 0; i < 50; i++ {
+		sets = append(sets, c.SetAsync(fmt.Sprintf("async-%d", i), []byte(fmt.Sprintf("async-value-%d", i)), 0))
+	}
+	for _, f := range sets {
+		r, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, Success, r, "Expected mutation to be stored successfully")
+	}
+
+	gets := make([]*Future[[]byte], 0, 50)
+	for i := 0; i < 50; i++ {
+		gets = append(gets, c.GetAsync(fmt.Sprintf("async-%d", i)))
+	}
+	for i, f := range gets {
+		v, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []byte(fmt.Sprintf("async-value-%d", i)), v, "Unexpected response value")
+	}
+
+	r, err := c.TouchAsync("async-0", 1000).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to update TTL successfully")
+
+	r, err = c.DeleteAsync("async-0").Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Success, r, "Expected mutation to delete entry successfully")
+
+	v, err := c.GetAsync("async-0").Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, v, "Expected nil value")
+}